@@ -7,51 +7,89 @@ type ident = { loc : location; id : string }
 
 type unop =
   | Uneg | Unot | Uamp | Ustar
+  | Ucompl (** ^x *)
 
 type binop =
   | Badd | Bsub | Bmul | Bdiv | Bmod
   | Beq | Bne | Blt | Ble | Bgt | Bge
   | Band | Bor (** && || *)
+  | Bbitand | Bbitor | Bxor | Bandnot | Bshl | Bshr (** & | ^ &^ << >> *)
 
 type constant =
   | Cbool of bool
   | Cint of int64
+  | Cfloat of float
   | Cstring of string
 
+type incdec = Inc | Dec (** ++ -- *)
+
 type ptyp =
   | PTident of ident (** bool, int, string, or struct id *)
   | PTptr   of ptyp
+  | PTarray of pexpr * ptyp (** constant length, element type *)
+  | PTslice of ptyp
+  | PTmap of ptyp * ptyp (** key and value types *)
 
-type incdec = Inc | Dec (** ++ -- *)
-
-type pexpr =
+and pexpr =
   { pexpr_desc : pexpr_desc;
     pexpr_loc  : location; }
 
 and pexpr_desc =
   | PEskip
   | PEconstant of constant
+  | PErune of int64 (** 'a', a constant of type rune *)
   | PEbinop of binop * pexpr * pexpr
   | PEunop of unop * pexpr
   | PEnil
   | PEcall of ident * pexpr list
   | PEident of ident
   | PEdot of pexpr * ident
+  | PEindex of pexpr * pexpr (** a[i] *)
+  | PEcomposite of ptyp option * (pexpr option * pexpr) list
+      (** [3]int{1, 2, 3}, Point{X: 1, Y: 2} or map[string]int{"a": 1},
+          whose elements may be keyed by a field name or a map key; the
+          type is omitted in {1, 2}, an element of an enclosing literal *)
   | PEassign of pexpr list * pexpr list
   | PEvars of ident list * ptyp option * pexpr list
+  | PEdefine of ident list * pexpr list
+      (** x, y := e1, e2, which may assign variables already declared *)
   | PEif of pexpr * pexpr * pexpr
   | PEreturn of pexpr list
   | PEblock of pexpr list
-  | PEfor of pexpr * pexpr
+  | PEfor of pexpr * pexpr * pexpr (** condition, post statement, body *)
   | PEincdec of pexpr * incdec
+  | PEopassign of binop * pexpr * pexpr (** x += e, ... *)
+  | PEbreak of ident option (** break L leaves the statement labeled L *)
+  | PEcontinue of ident option
+  | PElabel of ident * pexpr (** L: s, where s may be empty *)
+  | PEgoto of ident
+  | PEconsts of pconst list
+  | PEswitch of pexpr option * pcase list (** tag, clauses *)
+  | PEfallthrough
+  | PEdefer of pexpr (** a call *)
+  | PEspread of pexpr (** s..., the last argument of a call *)
 
 and pparam = ident * ptyp
 
+(** one line of a const declaration; in a group, a line without values
+    already holds a copy of the previous type and values *)
+and pconst = {
+  pc_names  : ident list;
+  pc_typ    : ptyp option;
+  pc_values : pexpr list;
+  pc_iota   : int; (** index of the line in its group *)
+}
+
+(** values of a case clause (None for default) and its body *)
+and pcase = pexpr list option * pexpr
+
 type pfunc = {
-  pf_name   : ident;
-  pf_params : pparam list;
-  pf_typ    : ptyp list;
-  pf_body   : pexpr;
+  pf_name    : ident;
+  pf_params  : pparam list;
+  pf_variadic: bool; (** the last parameter is ...T, of type []T *)
+  pf_results : ident list; (** names of the results, [] if not named *)
+  pf_typ     : ptyp list;
+  pf_body    : pexpr;
 }
 
 type pfield = ident * ptyp
@@ -61,10 +99,19 @@ type pstruct = {
   ps_fields : pfield list;
 }
 
+(** type T U declares a new type T, type T = U another name for U *)
+type ptype = {
+  pt_name  : ident;
+  pt_typ   : ptyp;
+  pt_alias : bool;
+}
+
 type pdecl =
   | PDfunction of pfunc
   | PDstruct   of pstruct
+  | PDtype     of ptype
+  | PDconsts   of pconst list
 
-type import_fmt = bool (** if `import "fmt"` is present *)
+type imports = ident list (** the packages imported, fmt or os *)
 
-type pfile = import_fmt * pdecl list
+type pfile = imports * pdecl list
@@ -0,0 +1,157 @@
+(** Integers of at most [limit] bits, the values of the untyped integer
+    constants, that Go computes exactly: 1 << 100 >> 98 is 4.
+
+    They are kept in two's complement on [width] bits, enough for the
+    product of two of them, as arrays of limbs of 16 bits, the lowest one
+    first; the bitwise operators are then those of the machine integers. *)
+
+let limit = 512
+let limbs = 68
+let width = 16 * limbs
+let mask = 0xFFFF
+
+type t = int array
+
+let is_negative a = a.(limbs - 1) land 0x8000 <> 0
+let is_zero a = Array.for_all (fun x -> x = 0) a
+
+(* the limb [i] of the infinite sign extension of [a] *)
+let limb a i =
+  if i < 0 then 0
+  else if i >= limbs then if is_negative a then mask else 0
+  else a.(i)
+
+(* the 16 bits of [a] from the bit [k], the ones below 0 being zeros *)
+let bits16 a k =
+  let i = k asr 4 and o = k land 15 in
+  ((limb a i lsr o) lor (limb a (i + 1) lsl (16 - o))) land mask
+
+let of_int64 n =
+  Array.init limbs (fun i ->
+      if i < 4 then
+        Int64.to_int (Int64.logand (Int64.shift_right n (16 * i)) 0xFFFFL)
+      else if n < 0L then mask
+      else 0)
+
+let one = of_int64 1L
+
+let add a b =
+  let r = Array.make limbs 0 and carry = ref 0 in
+  for i = 0 to limbs - 1 do
+    let s = a.(i) + b.(i) + !carry in
+    r.(i) <- s land mask;
+    carry := s lsr 16
+  done;
+  r
+
+let lognot a = Array.map (fun x -> lnot x land mask) a
+let logand a b = Array.map2 ( land ) a b
+let logor a b = Array.map2 ( lor ) a b
+let logxor a b = Array.map2 ( lxor ) a b
+let neg a = add (lognot a) one
+let sub a b = add a (neg b)
+let abs a = if is_negative a then neg a else a
+
+(* modulo 2^width, which keeps the sign of a product of two values *)
+let mul a b =
+  let r = Array.make limbs 0 in
+  for i = 0 to limbs - 1 do
+    if a.(i) <> 0 then begin
+      let carry = ref 0 in
+      for j = 0 to limbs - 1 - i do
+        let s = r.(i + j) + (a.(i) * b.(j)) + !carry in
+        r.(i + j) <- s land mask;
+        carry := s lsr 16
+      done
+    end
+  done;
+  r
+
+let shift_left a n = Array.init limbs (fun i -> bits16 a ((16 * i) - n))
+
+(* rounds toward minus infinity, as the shifts of Go do *)
+let shift_right a n =
+  Array.init limbs (fun i -> bits16 a ((16 * i) + min n width))
+
+let compare a b =
+  match (is_negative a, is_negative b) with
+  | true, false -> -1
+  | false, true -> 1
+  | _ ->
+      let rec from i =
+        if i < 0 then 0
+        else if a.(i) <> b.(i) then Int.compare a.(i) b.(i)
+        else from (i - 1)
+      in
+      from (limbs - 1)
+
+(* the number of bits of |a| *)
+let bits a =
+  let a = abs a in
+  let rec size x = if x = 0 then 0 else 1 + size (x lsr 1) in
+  let rec from i =
+    if i < 0 then 0
+    else if a.(i) <> 0 then (16 * i) + size a.(i)
+    else from (i - 1)
+  in
+  from (limbs - 1)
+
+(* the quotient and the remainder of |a| by |b|, bit after bit *)
+let divmod_abs a b =
+  let a = abs a and b = abs b in
+  let q = Array.make limbs 0 and r = ref (Array.make limbs 0) in
+  for k = bits a - 1 downto 0 do
+    r := shift_left !r 1;
+    !r.(0) <- !r.(0) lor ((a.(k / 16) lsr (k mod 16)) land 1);
+    if compare !r b >= 0 then begin
+      r := sub !r b;
+      q.(k / 16) <- q.(k / 16) lor (1 lsl (k mod 16))
+    end
+  done;
+  (q, !r)
+
+(* truncated toward zero, the remainder having the sign of [a], as the
+   division of Go; [b] is not zero *)
+let div a b =
+  let q, _ = divmod_abs a b in
+  if is_negative a <> is_negative b then neg q else q
+
+let rem a b =
+  let _, r = divmod_abs a b in
+  if is_negative a then neg r else r
+
+let to_int64 a =
+  let n = ref 0L in
+  for i = 3 downto 0 do
+    n := Int64.logor (Int64.shift_left !n 16) (Int64.of_int a.(i))
+  done;
+  if a = of_int64 !n then Some !n else None
+
+(* a value of uint64, kept by its bits as the constants of that type *)
+let to_uint64 a =
+  if is_negative a || bits a > 64 then None
+  else
+    let n = ref 0L in
+    for i = 3 downto 0 do
+      n := Int64.logor (Int64.shift_left !n 16) (Int64.of_int a.(i))
+    done;
+    Some !n
+
+let to_string a =
+  let digits = Buffer.create 16 in
+  let rec decimal a =
+    (* a divided by 10, from the highest limb *)
+    let q = Array.make limbs 0 and r = ref 0 in
+    for i = limbs - 1 downto 0 do
+      let x = (!r lsl 16) lor a.(i) in
+      q.(i) <- x / 10;
+      r := x mod 10
+    done;
+    if not (is_zero q) then decimal q;
+    Buffer.add_char digits (Char.chr (Char.code '0' + !r))
+  in
+  decimal (abs a);
+  (if is_negative a then "-" else "") ^ Buffer.contents digits
+
+(* the nearest float64, as float_of_string rounds a decimal number *)
+let to_float a = float_of_string (to_string a)
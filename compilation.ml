@@ -6,6 +6,9 @@ module StringSet = Set.Make (String)
 module CompilationUtils = struct
   let fold_left_concat f = List.fold_left (fun acc x -> acc ++ f x) nop
 
+  (* _ has no storage: what is assigned to it is computed, then dropped *)
+  let is_blank v = Typing_types.Constants.is_blank v.v_name
+
   let new_label =
     let r = ref 0 in
     fun () ->
@@ -13,6 +16,101 @@ module CompilationUtils = struct
       "L_" ^ string_of_int !r
 end
 
+(* labels of user functions, prefixed so that they never clash with libc *)
+module FunctionLabels = struct
+  let of_name name = if name = "main" then "main" else "F_" ^ name
+
+  (* every return jumps to the epilogue of the function being compiled *)
+  let return_label = ref ""
+  let epilogue_of_name name = "R_" ^ name
+
+  (* the labels of the gotos are local to the function, whose epilogue
+     names it *)
+  let of_goto label = !return_label ^ "." ^ label
+end
+
+(* the line table of the debug information, emitted with -g: a .loc
+   directive before the code of each function and statement, whose source
+   file is numbered by a .file directive; the assembler builds the
+   sections that debuggers read from them *)
+module DebugInfo = struct
+  let enabled = ref false
+  let files : (string, int) Hashtbl.t = Hashtbl.create 8
+
+  let file_number name =
+    match Hashtbl.find_opt files name with
+    | Some n -> n
+    | None ->
+        let n = Hashtbl.length files + 1 in
+        Hashtbl.add files name n;
+        n
+
+  (* the text of the line where a position is, to annotate the assembly
+     that is printed with -S *)
+  let source : (Lexing.position -> string) option ref = ref None
+
+  let annotation (b : Lexing.position) : text =
+    match !source with
+    | Some source ->
+        comment
+          (Printf.sprintf " %s:%d: %s" b.pos_fname b.pos_lnum
+             (String.trim (source b)))
+    | None -> nop
+
+  let line ((b, _) : Ast.location) : text =
+    if !enabled && b.Lexing.pos_fname <> "" then
+      annotation b
+      ++ inline
+           (Printf.sprintf "\t.loc %d %d %d\n" (file_number b.pos_fname)
+              b.pos_lnum
+              (b.pos_cnum - b.pos_bol + 1))
+    else nop
+
+  (* to put before the .loc directives *)
+  let file_directives () : text =
+    let numbered = Hashtbl.fold (fun name n l -> (n, name) :: l) files [] in
+    CompilationUtils.fold_left_concat
+      (fun (n, name) -> inline (Printf.sprintf "\t.file %d %S\n" n name))
+      (List.sort compare numbered)
+end
+
+(* break and continue targets of the enclosing loops, innermost first *)
+module LoopLabels = struct
+  type t = { break_label : string; continue_label : string }
+
+  let stack : t list ref = ref []
+  let push l = stack := l :: !stack
+  let pop () = stack := List.tl !stack
+
+  let innermost () =
+    match !stack with
+    | l :: _ -> l
+    | [] -> failwith "break or continue outside of a loop"
+
+  (* a break in a switch leaves the switch, a continue still goes to the
+     enclosing loop, if there is one *)
+  let push_switch break_label =
+    let continue_label =
+      match !stack with l :: _ -> l.continue_label | [] -> ""
+    in
+    push { break_label; continue_label }
+end
+
+(* the calls deferred by the function being compiled are linked, the last
+   one first, from a slot below its variables, and made when it returns *)
+module Defers = struct
+  let slot = ref 0
+
+  let rec occur (e : expr) : bool =
+    match e.expr_desc with
+    | TEdefer _ -> true
+    | TEblock el -> List.exists occur el
+    | TEif (_, e1, e2) -> occur e1 || occur e2
+    | TEfor (_, _, body) -> occur body
+    | TEswitch clauses -> List.exists (fun (_, body, _) -> occur body) clauses
+    | _ -> false
+end
+
 module BoolOps = struct
   (* it tells you how are booleans represented in the assembly *)
   let true_value = 1
@@ -27,15 +125,21 @@ end
 module Constants = struct
   (* printf format strings *)
   let format_int_label = ".Sint"
+  let format_uint_label = ".Suint"
   let format_string_label = ".Sstr"
 
   (* custom print values *)
   let format_true_label = ".Strue"
   let format_false_label = ".Sfalse"
   let format_nil_label = ".Snil"
+  let format_pointer_label = ".Sptr"
   let format_false_value = "false"
   let format_true_value = "true"
   let format_nil_value = "<nil>"
+  let format_pointer_value = "0x%lx"
+
+  (* the header of os.Args, filled by main *)
+  let args_label = ".Sargs"
 
   (* Prefix for string constant labels *)
   let string_label_prefix = ".SStrConst"
@@ -44,6 +148,26 @@ module Constants = struct
   let function_printf_label = "printf_"
   let function_malloc_label = "malloc_"
   let function_calloc_label = "calloc_"
+  let function_strcmp_label = "strcmp_"
+  let function_strlen_label = "strlen_"
+  let function_print_float_label = "print_float_"
+  let function_format_float_label = "format_float_"
+  let function_format_label = "format_"
+  let function_concat_label = "concat_"
+  let function_memmove_label = "memmove_"
+  let function_index_error_label = "index_error_"
+  let function_panic_label = "panic_"
+  let function_run_defers_label = "run_defers_"
+  let function_append_label = "append_"
+  let function_rune_string_label = "rune_string_"
+  let function_digits_label = "digits_"
+  let function_pad_label = "pad_"
+  let function_exit_label = "exit_"
+  let function_map_make_label = "map_make_"
+  let function_map_lookup_label = "map_lookup_"
+  let function_map_assign_label = "map_assign_"
+  let function_map_delete_label = "map_delete_"
+  let function_map_sorted_label = "map_sorted_"
 end
 
 module SizeConstants = struct
@@ -82,6 +206,20 @@ module StringTable = struct
   let mem (s : string) : bool = Hashtbl.mem !instance.table s
 end
 
+(* the statement being compiled and its function, which a panic reports, as
+   Go does, in the terms of the source *)
+module Position = struct
+  let function_name = ref ""
+  let current = ref Typing_error.dummy_loc
+
+  (* the label of the string describing the current position *)
+  let label () : string =
+    let b, _ = !current in
+    StringTable.add
+      (Printf.sprintf "main.%s()\n\t%s:%d" !function_name b.Lexing.pos_fname
+         b.pos_lnum)
+end
+
 (* Data section generation *)
 module Data = struct
   (* Traverse entire Tast tree and collect string constants *)
@@ -89,6 +227,7 @@ module Data = struct
     match e.expr_desc with
     | TEconstant (Cstring s) -> ignore (StringTable.add s)
     | TEprint exprs -> List.iter visit_expr exprs
+    | TEprintf pieces | TEsprintf pieces -> List.iter visit_piece pieces
     | TEblock exprs -> List.iter visit_expr exprs
     | TEbinop (_, e1, e2) ->
         visit_expr e1;
@@ -102,13 +241,51 @@ module Data = struct
         visit_expr e1;
         visit_expr e2;
         visit_expr e3
-    | TEfor (e1, e2) ->
+    | TEfor (e1, e2, e3) ->
         visit_expr e1;
-        visit_expr e2
+        visit_expr e2;
+        visit_expr e3
+    | TEswitch clauses ->
+        List.iter
+          (fun (conds, body, _) ->
+            Lib.option_iter (List.iter visit_expr) conds;
+            visit_expr body)
+          clauses
     | TEdot (e, _) -> visit_expr e
+    | TEindex (e1, e2) ->
+        visit_expr e1;
+        visit_expr e2
+    | TEarray exprs -> List.iter visit_expr exprs
+    | TEstruct fields -> List.iter (fun (_, e) -> visit_expr e) fields
+    | TEmap entries ->
+        List.iter
+          (fun (k, v) ->
+            visit_expr k;
+            visit_expr v)
+          entries
+    | TEcontains (e1, e2) | TEdelete (e1, e2) ->
+        visit_expr e1;
+        visit_expr e2
+    | TElen e | TEconvert e | TEpanic e | TEexit e | TEdefer e ->
+        visit_expr e
+    | TEappend (e, exprs) -> List.iter visit_expr (e :: exprs)
     | TEreturn exprs -> List.iter visit_expr exprs
+    | TEopassign (_, e1, e2) ->
+        visit_expr e1;
+        visit_expr e2
     | _ -> ()
 
+  and visit_piece = function
+    | Fstring s -> ignore (StringTable.add s)
+    | Fverb (spec, e) ->
+        ignore (StringTable.add spec);
+        visit_expr e
+    | Fdigits (digits, e) ->
+        ignore (StringTable.add digits);
+        visit_expr e
+    | Ffloat e -> visit_expr e
+    | Fpad (_, _, p) -> visit_piece p
+
   let visit_decl (td : Tast.tdecl) : unit =
     match td with TDfunction (_, body) -> visit_expr body | _ -> ()
 
@@ -122,7 +299,9 @@ module Data = struct
   let generate_format_constants () : X86_64.data =
     let open X86_64 in
     label Constants.format_int_label
-    ++ string "%d"
+    ++ string "%ld"
+    ++ label Constants.format_uint_label
+    ++ string "%lu"
     ++ label Constants.format_string_label
     ++ string "%s"
     ++ label Constants.format_true_label
@@ -131,6 +310,8 @@ module Data = struct
     ++ string Constants.format_false_value
     ++ label Constants.format_nil_label
     ++ string Constants.format_nil_value
+    ++ label Constants.format_pointer_label
+    ++ string Constants.format_pointer_value
 
   (* Generate string constant data *)
   let generate_string_constants () : X86_64.data =
@@ -141,13 +322,13 @@ module Data = struct
       nop strings
 
   (* Generate complete data section *)
-  let generate_data_section (tfile : Tast.tfile) : X86_64.data =
+  (* strings must have been collected before the code generation *)
+  let generate_data_section () : X86_64.data =
     let open X86_64 in
-    (* First, collect all strings *)
-    collect_strings tfile;
-
-    (* Generate both user strings and format constants *)
-    generate_string_constants () ++ generate_format_constants ()
+    (* Generate both user strings and format constants, after the header of
+       os.Args that must be aligned *)
+    label Constants.args_label ++ dquad [ 0; 0; 0 ]
+    ++ generate_string_constants () ++ generate_format_constants ()
 end
 
 module Allocation = struct
@@ -158,8 +339,9 @@ module Allocation = struct
   end
 
   (* Look up actual field offset from allocated structure *)
-  let get_field_offset (expr_typ : typ) (field : field) : int =
+  let rec get_field_offset (expr_typ : typ) (field : field) : int =
     match expr_typ with
+    | Tptr t -> get_field_offset t field
     | Tstruct s -> (
         match StructTable.find s.s_name with
         | Some s_allocated -> (
@@ -173,12 +355,13 @@ module Allocation = struct
         | None -> field.f_ofs)
     | _ -> field.f_ofs
 
-  let sizeof (t : typ) : int =
+  let rec sizeof (t : typ) : int =
     match t with
     | Tstruct s -> (
         match StructTable.find s.s_name with
         | Some allocated_struct -> allocated_struct.s_size
         | None -> failwith ("Structure " ^ s.s_name ^ " not allocated yet"))
+    | Tarray (t, n) -> n * sizeof t
     | _ -> SizeConstants.standard_field_size_bytes
 
   (* Calculates offset of fields and size of entire structure *)
@@ -195,15 +378,18 @@ module Allocation = struct
         List.iter
           (fun f ->
             f.f_ofs <- !offset;
-            (match f.f_typ with
-            | Tstruct nested -> allocate_structure nested
-            | _ -> ());
+            (* the size of the inner structures is needed first, including
+               those that are elements of arrays *)
+            let rec allocate_nested = function
+              | Tstruct nested -> allocate_structure nested
+              | Tarray (t, _) -> allocate_nested t
+              | _ -> ()
+            in
+            allocate_nested f.f_typ;
             offset := !offset + sizeof f.f_typ)
           s.s_list;
 
         s.s_size <- !offset;
-        (* print info about structure *)
-        Printf.printf "Allocated structure %s with size %d\n" s.s_name s.s_size;
         allocated_structures := StringSet.add s.s_name !allocated_structures;
         StructTable.add s
       end
@@ -225,8 +411,10 @@ module Allocation = struct
       | TEvars var_list ->
           List.iter
             (fun v ->
-              offset := !offset - 8;
-              v.v_ofs <- !offset)
+              if not (CompilationUtils.is_blank v) then begin
+                offset := !offset - 8;
+                v.v_ofs <- !offset
+              end)
             var_list
       | TEbinop (_, e1, e2) ->
           visit_expr e1;
@@ -234,6 +422,23 @@ module Allocation = struct
       | TEunop (_, e) -> visit_expr e
       | TEcall (_, exprs) -> List.iter visit_expr exprs
       | TEdot (e, _) -> visit_expr e
+      | TEindex (e1, e2) ->
+          visit_expr e1;
+          visit_expr e2
+      | TEarray exprs -> List.iter visit_expr exprs
+      | TEstruct fields -> List.iter (fun (_, e) -> visit_expr e) fields
+      | TEmap entries ->
+          List.iter
+            (fun (k, v) ->
+              visit_expr k;
+              visit_expr v)
+            entries
+      | TEcontains (e1, e2) | TEdelete (e1, e2) ->
+          visit_expr e1;
+          visit_expr e2
+      | TElen e | TEconvert e | TEpanic e | TEexit e | TEdefer e ->
+        visit_expr e
+      | TEappend (e, exprs) -> List.iter visit_expr (e :: exprs)
       | TEassign (lhs, rhs) ->
           List.iter visit_expr lhs;
           List.iter visit_expr rhs
@@ -243,11 +448,28 @@ module Allocation = struct
           visit_expr e3
       | TEreturn exprs -> List.iter visit_expr exprs
       | TEblock exprs -> List.iter visit_expr exprs
-      | TEfor (e1, e2) ->
+      | TEfor (e1, e2, e3) ->
           visit_expr e1;
-          visit_expr e2
+          visit_expr e2;
+          visit_expr e3
+      | TEswitch clauses ->
+          List.iter
+            (fun (conds, body, _) ->
+              Lib.option_iter (List.iter visit_expr) conds;
+              visit_expr body)
+            clauses
       | TEprint exprs -> List.iter visit_expr exprs
+      | TEprintf pieces | TEsprintf pieces ->
+          let rec visit_piece = function
+            | Fverb (_, e) | Fdigits (_, e) | Ffloat e -> visit_expr e
+            | Fpad (_, _, p) -> visit_piece p
+            | Fstring _ -> ()
+          in
+          List.iter visit_piece pieces
       | TEincdec (e, _) -> visit_expr e
+      | TEopassign (_, e1, e2) ->
+          visit_expr e1;
+          visit_expr e2
       | _ -> ()
     in
 
@@ -283,190 +505,1090 @@ module Compilation = struct
         leaq (lab lbl) rax
     | Cbool b -> movq (imm (BoolOps.to_asm_value b)) (reg rax)
     | Cint i -> movq (imm64 i) (reg rax)
+    | Cfloat f -> movq (imm64 (Int64.bits_of_float f)) (reg rax)
+
+  (* arrays and structures are the address of their elements, or fields,
+     stored one after the other, those of the inner arrays and structures
+     included *)
+  let is_aggregate = function Tarray _ | Tstruct _ -> true | _ -> false
+
+  let rec has_strings = function
+    | Tstring -> true
+    | Tarray (t, _) -> has_strings t
+    | Tstruct s -> List.exists (fun f -> has_strings f.f_typ) s.s_list
+    | _ -> false
+
+  (* stops the program with the message in rdi, reporting the current
+     position *)
+  let panic () : text =
+    leaq (lab (Position.label ())) rsi ++ call Constants.function_panic_label
+
+  (* main receives argc in rdi and argv in rsi, that os.Args refers to; a
+     call of main from the program keeps them *)
+  let store_args () : text =
+    let lbl_stored = CompilationUtils.new_label () in
+    leaq (lab Constants.args_label) rax
+    ++ cmpq (imm 0) (ind rax)
+    ++ jne lbl_stored
+    ++ movq (reg rsi) (ind rax)
+    ++ movq (reg rdi) (ind ~ofs:8 rax)
+    ++ movq (reg rdi) (ind ~ofs:16 rax)
+    ++ label lbl_stored
+
+  (* the errors that Go detects at run time stop the program the same way *)
+  let runtime_error (message : string) : text =
+    leaq (lab (StringTable.add ("runtime error: " ^ message))) rdi ++ panic ()
+
+  (* the address in rax must not be nil *)
+  let nil_check () : text =
+    let lbl_ok = CompilationUtils.new_label () in
+    testq (reg rax) (reg rax)
+    ++ jnz lbl_ok
+    ++ runtime_error "invalid memory address or nil pointer dereference"
+    ++ label lbl_ok
+
+  (* a zeroed block of size bytes, in rax *)
+  let allocate (size : int) : text =
+    movq (imm 1) (reg rdi)
+    ++ movq (imm size) (reg rsi)
+    ++ call Constants.function_calloc_label
+
+  (* the zero value of a string is the empty one, not a null address: the
+     strings of the zeroed value of type t at the address in rax are set to
+     it, the elements of an array in a loop whose counter is kept on the
+     stack *)
+  let empty_strings (t : typ) : text =
+    let rec fill t ofs =
+      match t with
+      | Tstring -> movq (reg rcx) (ind ~ofs rax)
+      | Tstruct s ->
+          CompilationUtils.fold_left_concat
+            (fun f -> fill f.f_typ (ofs + Allocation.get_field_offset t f))
+            s.s_list
+      | Tarray (t, n) when n > 0 && has_strings t ->
+          let lbl_loop = CompilationUtils.new_label () in
+          pushq (reg rax)
+          ++ addq (imm ofs) (reg rax)
+          ++ movq (imm n) (reg rdx)
+          ++ label lbl_loop
+          ++ pushq (reg rdx)
+          ++ fill t 0
+          ++ popq rdx
+          ++ addq (imm (Allocation.sizeof t)) (reg rax)
+          ++ decq (reg rdx)
+          ++ jnz lbl_loop
+          ++ popq rax
+      | _ -> nop
+    in
+    if has_strings t then leaq (lab (StringTable.add "")) rcx ++ fill t 0
+    else nop
+
+  let zero (t : typ) : text =
+    match t with
+    | Tstring -> leaq (lab (StringTable.add "")) rax
+    | Tarray _ | Tstruct _ -> allocate (Allocation.sizeof t) ++ empty_strings t
+    | _ -> xorq (reg rax) (reg rax)
+
+  (* arrays and structures are values: the one in rax is replaced by a fresh
+     copy *)
+  let copy (t : typ) : text =
+    if not (is_aggregate t) then nop
+    else
+      let size = Allocation.sizeof t in
+      pushq (reg rax)
+      ++ movq (imm size) (reg rdi)
+      ++ call Constants.function_malloc_label
+      ++ movq (reg rax) (reg rdi)
+      ++ popq rsi
+      ++ movq (imm size) (reg rdx)
+      ++ call Constants.function_memmove_label
+
+  (* a slice is the address of a header that is never modified: the address
+     of the elements, their number, and the capacity; nil is a null address.
+     The header in h is replaced by the address of the elements, and their
+     number is put in len *)
+  let slice_header (h : [ `Q ] register) (len : [ `Q ] register) : text =
+    let lbl_nil = CompilationUtils.new_label () in
+    xorq (reg len) (reg len)
+    ++ testq (reg h) (reg h)
+    ++ jz lbl_nil
+    ++ movq (ind ~ofs:8 h) (reg len)
+    ++ movq (ind h) (reg h)
+    ++ label lbl_nil
+
+  (* puts the address of a[i] in rax; an index out of range stops the
+     program *)
+  let element_address (compile_expr : expr -> text) (a : expr) (i : expr) :
+      text =
+    let t, length =
+      match a.expr_typ with
+      | Tarray (t, n) -> (t, movq (imm n) (reg rdx))
+      | Tslice t -> (t, slice_header rcx rdx)
+      | _ -> failwith "only arrays and slices can be indexed"
+    in
+    let lbl_ok = CompilationUtils.new_label () in
+    compile_expr a
+    ++ pushq (reg rax)
+    ++ compile_expr i
+    ++ popq rcx
+    ++ length
+    (* a negative index is a large unsigned one *)
+    ++ cmpq (reg rdx) (reg rax)
+    ++ jb lbl_ok
+    ++ movq (reg rax) (reg rdi)
+    ++ movq (reg rdx) (reg rsi)
+    ++ leaq (lab (Position.label ())) rdx
+    ++ call Constants.function_index_error_label
+    ++ label lbl_ok
+    ++
+    match Allocation.sizeof t with
+    | 8 -> leaq (ind ~index:rax ~scale:8 rcx) rax
+    | size -> imulq (imm size) (reg rax) ++ addq (reg rcx) (reg rax)
+
+  (* appends the elements el of type t to the slice in rax: the runtime makes
+     room for them, and they are then stored at the end of the new slice *)
+  let append (compile_expr : expr -> text) (t : typ) (el : expr list) : text =
+    let n = List.length el in
+    let size = Allocation.sizeof t in
+    let store i e =
+      let ofs = (i - n) * size in
+      pushq (reg rax)
+      ++ compile_expr e
+      ++ movq (ind rsp) (reg rcx)
+      ++ movq (ind ~ofs:8 rcx) (reg rdx)
+      ++ imulq (imm size) (reg rdx)
+      ++ addq (ind rcx) (reg rdx)
+      ++ (if is_aggregate t then
+            leaq (ind ~ofs rdx) rdi
+            ++ movq (reg rax) (reg rsi)
+            ++ movq (imm size) (reg rdx)
+            ++ call Constants.function_memmove_label
+          else movq (reg rax) (ind ~ofs rdx))
+      ++ popq rax
+    in
+    movq (reg rax) (reg rdi)
+    ++ movq (imm n) (reg rsi)
+    ++ movq (imm size) (reg rdx)
+    ++ call Constants.function_append_label
+    ++ CompilationUtils.fold_left_concat (fun x -> x) (List.mapi store el)
+
+  (* the values of an array or structure literal, given with their offset
+     and type, are stored in a fresh zero one, those that are arrays or
+     structures being copied *)
+  let literal (compile_expr : expr -> text) (t : typ)
+      (values : (int * typ * expr) list) : text =
+    let store (ofs, t, e) =
+      pushq (reg rax)
+      ++ compile_expr e
+      ++ (if is_aggregate t then
+            movq (reg rax) (reg rsi)
+            ++ movq (ind rsp) (reg rdi)
+            ++ addq (imm ofs) (reg rdi)
+            ++ movq (imm (Allocation.sizeof t)) (reg rdx)
+            ++ call Constants.function_memmove_label
+          else movq (ind rsp) (reg rcx) ++ movq (reg rax) (ind ~ofs rcx))
+      ++ popq rax
+    in
+    zero t ++ CompilationUtils.fold_left_concat store values
+
+  let array_literal (compile_expr : expr -> text) (t : typ) (el : expr list)
+      : text =
+    let elt = match t with Tarray (t, _) -> t | _ -> assert false in
+    let size = Allocation.sizeof elt in
+    literal compile_expr t (List.mapi (fun i e -> (i * size, elt, e)) el)
+
+  let struct_literal (compile_expr : expr -> text) (t : typ)
+      (fields : (field * expr) list) : text =
+    literal compile_expr t
+      (List.map
+         (fun (f, e) -> (Allocation.get_field_offset t f, f.f_typ, e))
+         fields)
+
+  (* a map is the address of a header handled by the runtime, whose first
+     word is the number of keys; the functions of Runtime.map are called
+     with the map in rdi and the key in rsi *)
+  let map_key_kind = function Tstring -> 1 | Tfloat -> 2 | _ -> 0
+
+  (* the slots of the values have at least 8 bytes, so that the address of
+     a value is never null *)
+  let map_make (k : typ) (v : typ) : text =
+    movq (imm (max 8 (Allocation.sizeof v))) (reg rdi)
+    ++ movq (imm (map_key_kind k)) (reg rsi)
+    ++ call Constants.function_map_make_label
+
+  let map_call ?(args = nop) (compile_expr : expr -> text) (f : string)
+      (m : expr) (k : expr) : text =
+    compile_expr m
+    ++ pushq (reg rax)
+    ++ compile_expr k
+    ++ movq (reg rax) (reg rsi)
+    ++ popq rdi
+    ++ args
+    ++ call f
+
+  (* stores the value of type t in rsi at the address in rax *)
+  let store_value (t : typ) : text =
+    if is_aggregate t then
+      movq (reg rax) (reg rdi)
+      ++ movq (imm (Allocation.sizeof t)) (reg rdx)
+      ++ call Constants.function_memmove_label
+    else movq (reg rsi) (ind rax)
+
+  let map_literal (compile_expr : expr -> text) (t : typ)
+      (entries : (expr * expr) list) : text =
+    let k, v = match t with Tmap (k, v) -> (k, v) | _ -> assert false in
+    let entry (ke, ve) =
+      pushq (reg rax)
+      ++ compile_expr ke
+      ++ pushq (reg rax)
+      ++ compile_expr ve
+      ++ popq rsi
+      ++ movq (ind rsp) (reg rdi)
+      ++ pushq (reg rax)
+      ++ call Constants.function_map_assign_label
+      ++ popq rsi
+      ++ store_value v
+      ++ popq rax
+    in
+    map_make k v ++ CompilationUtils.fold_left_concat entry entries
+
+  (* the value of type t of m[k], the zero one when k is not in m *)
+  let map_index (compile_expr : expr -> text) (m : expr) (k : expr) (t : typ)
+      : text =
+    let lbl_found = CompilationUtils.new_label () in
+    let lbl_end = CompilationUtils.new_label () in
+    map_call compile_expr Constants.function_map_lookup_label m k
+    ++ testq (reg rax) (reg rax)
+    ++ jnz lbl_found
+    ++ zero t
+    ++ jmp lbl_end
+    ++ label lbl_found
+    ++ (if is_aggregate t then nop else movq (ind rax) (reg rax))
+    ++ label lbl_end
+
+  (* puts the address of the value of m[k] in rax, k being inserted if it
+     was not in m *)
+  let map_element_address (compile_expr : expr -> text) (m : expr) (k : expr)
+      (t : typ) : text =
+    let lbl_old = CompilationUtils.new_label () in
+    (* a nil map stops the program, at this position *)
+    let position = leaq (lab (Position.label ())) rdx in
+    map_call ~args:position compile_expr Constants.function_map_assign_label m
+      k
+    ++
+    if has_strings t then
+      testq (reg rdx) (reg rdx) ++ jz lbl_old ++ empty_strings t ++ label lbl_old
+    else nop
+
+  (* the integers of the other types are kept sign or zero extended to 64
+     bits: the result of an operation is truncated to its type, so that it
+     wraps around as in Go *)
+  let wrap (t : typ) : text =
+    match t with
+    | Tinteger (8, true) -> movsbq (reg al) rax
+    | Tinteger (8, false) -> movzbq (reg al) rax
+    | Tinteger (16, true) -> movswq (reg ax) rax
+    | Tinteger (16, false) -> movzwq (reg ax) rax
+    | Tinteger (32, true) -> movslq (reg eax) rax
+    | Tinteger (32, false) -> movl (reg eax) (reg eax)
+    | _ -> nop
+
+  (* the value of e converted to the type t; a float64 is truncated toward
+     zero, and then wraps around to the integer type like any integer *)
+  let convert (compile_expr : expr -> text) (t : typ) (e : expr) : text =
+    compile_expr e
+    ++
+    match (e.expr_typ, t) with
+    | Tfloat, Tfloat -> nop
+    | Tinteger (64, false), Tfloat ->
+        (* a value of 2^63 or more is halved, keeping its last bit so that
+           it is rounded the same, converted, and doubled *)
+        let lbl_large = CompilationUtils.new_label () in
+        let lbl_end = CompilationUtils.new_label () in
+        testq (reg rax) (reg rax)
+        ++ js lbl_large
+        ++ cvtsi2sdq (reg rax) xmm0
+        ++ jmp lbl_end
+        ++ label lbl_large
+        ++ movq (reg rax) (reg rcx)
+        ++ shrq (imm 1) (reg rcx)
+        ++ andq (imm 1) (reg rax)
+        ++ orq (reg rax) (reg rcx)
+        ++ cvtsi2sdq (reg rcx) xmm0
+        ++ addsd xmm0 xmm0
+        ++ label lbl_end
+        ++ movq_of_xmm xmm0 rax
+    | _, Tfloat -> cvtsi2sdq (reg rax) xmm0 ++ movq_of_xmm xmm0 rax
+    | Tfloat, Tinteger (64, false) ->
+        (* from 2^63 on, 2^63 is subtracted before, and added after, the
+           conversion to a signed integer *)
+        let lbl_large = CompilationUtils.new_label () in
+        let lbl_end = CompilationUtils.new_label () in
+        movq_to_xmm rax xmm0
+        ++ movq (imm64 0x43e0000000000000L) (reg rcx)
+        ++ movq_to_xmm rcx xmm1
+        ++ ucomisd xmm1 xmm0
+        ++ jae lbl_large
+        ++ cvttsd2siq xmm0 rax
+        ++ jmp lbl_end
+        ++ label lbl_large
+        ++ subsd xmm1 xmm0
+        ++ cvttsd2siq xmm0 rax
+        ++ movq (imm64 Int64.min_int) (reg rcx)
+        ++ xorq (reg rcx) (reg rax)
+        ++ label lbl_end
+    | Tfloat, _ -> movq_to_xmm rax xmm0 ++ cvttsd2siq xmm0 rax ++ wrap t
+    | _, Tstring ->
+        movq (reg rax) (reg rdi) ++ call Constants.function_rune_string_label
+    | _ -> wrap t
 
   let unop (compile_expr : expr -> text) (op : Tast.unop) (e : Tast.expr) : text
       =
     match op with
-    | Uneg -> compile_expr e ++ negq (reg rax)
+    | Uneg when e.expr_typ = Tfloat ->
+        (* flips the sign bit *)
+        compile_expr e
+        ++ movq (imm64 Int64.min_int) (reg rcx)
+        ++ xorq (reg rcx) (reg rax)
+    | Uneg -> compile_expr e ++ negq (reg rax) ++ wrap e.expr_typ
+    | Ucompl -> compile_expr e ++ notq (reg rax) ++ wrap e.expr_typ
     | Unot -> compile_expr e ++ BoolOps.generate_negation_code
+    (* the address of an array or structure is the value itself *)
+    | Uamp when is_aggregate e.expr_typ -> compile_expr e
     | Uamp -> (
         match e.expr_desc with
         | TEident v -> leaq (ind ~ofs:v.v_ofs rbp) rax
-        | TEdot (ee, field) -> (
-            let offset = Allocation.get_field_offset ee.expr_typ field in
-            match ee.expr_desc with
-            | TEunop (Ustar, ptr_expr) ->
-                (* Already dereferenced in AST, just get pointer *)
-                compile_expr ptr_expr ++ leaq (ind ~ofs:offset rax) rax
-            | _ -> compile_expr ee ++ leaq (ind ~ofs:offset rax) rax)
+        | TEindex (a, i) -> element_address compile_expr a i
+        | TEdot (ee, field) ->
+            compile_expr ee
+            ++ (match ee.expr_typ with Tptr _ -> nil_check () | _ -> nop)
+            ++ addq (imm (Allocation.get_field_offset ee.expr_typ field)) (reg rax)
         | TEunop (Ustar, e) -> compile_expr e
         | _ -> failwith "Cannot take address of non-variable expression")
-    | Ustar -> compile_expr e ++ movq (ind rax) (reg rax)
+    | Ustar when (match e.expr_typ with Tptr t -> is_aggregate t | _ -> false) ->
+        compile_expr e ++ nil_check ()
+    | Ustar -> compile_expr e ++ nil_check () ++ movq (ind rax) (reg rax)
+
+  (* replaces the boolean in rax by the address of "true" or "false" *)
+  let bool_to_string () : text =
+    (* labels for branches *)
+    let lbl_true = CompilationUtils.new_label () in
+    let lbl_end = CompilationUtils.new_label () in
+
+    (* compare bool with value 0 *)
+    cmpq (imm 0) (reg rax)
+    ++ jne lbl_true
+    ++
+    (* case false *)
+    leaq (lab Constants.format_false_label) rax
+    ++ jmp lbl_end
+    ++
+    (* case true *)
+    label lbl_true
+    ++ leaq (lab Constants.format_true_label) rax
+    ++ label lbl_end
+
+  (* prints rax using the printf format stored at the given label *)
+  (* first argument in rdi (format string), second in rsi (value)*)
+  let printf_rax (format_label : string) : text =
+    leaq (lab format_label) rdi
+    ++ movq (reg rax) (reg rsi)
+    ++ call Constants.function_printf_label
+
+  let print_string (s : string) : text =
+    leaq (lab (StringTable.add s)) rax
+    ++ printf_rax Constants.format_string_label
+
+  (* prints the value of type t in rax; as in Go, a pointer to an array or
+     structure is printed as &value when it is not inside another value *)
+  let rec print_value ?(top = false) (t : typ) : text =
+    match t with
+    | Tstring -> printf_rax Constants.format_string_label
+    | Tinteger (64, false) -> printf_rax Constants.format_uint_label
+    | Tint | Tinteger _ -> printf_rax Constants.format_int_label
+    | Tfloat ->
+        movq (reg rax) (reg rdi) ++ call Constants.function_print_float_label
+    | Tbool ->
+        (* rax has 0 or 1, replace it by the string to print *)
+        bool_to_string () ++ printf_rax Constants.format_string_label
+    | Tarray (t, n) -> movq (imm n) (reg rcx) ++ print_elements t
+    | Tslice t -> slice_header rax rcx ++ print_elements t
+    | Tstruct s ->
+        (* {f1 f2 ... fn}, the address of the fields being kept on the stack *)
+        let field i f =
+          (if i = 0 then nop else print_string " ")
+          ++ movq (ind rsp) (reg rax)
+          ++ (let ofs = Allocation.get_field_offset t f in
+              if is_aggregate f.f_typ then addq (imm ofs) (reg rax)
+              else movq (ind ~ofs rax) (reg rax))
+          ++ print_value f.f_typ
+        in
+        pushq (reg rax)
+        ++ print_string "{"
+        ++ CompilationUtils.fold_left_concat (fun x -> x) (List.mapi field s.s_list)
+        ++ popq rax
+        ++ print_string "}"
+    | Tptr t ->
+        let lbl_nil = CompilationUtils.new_label () in
+        let lbl_end = CompilationUtils.new_label () in
+        testq (reg rax) (reg rax)
+        ++ jz lbl_nil
+        ++ (if top && is_aggregate t then
+              pushq (reg rax) ++ print_string "&" ++ popq rax ++ print_value t
+            else printf_rax Constants.format_pointer_label)
+        ++ jmp lbl_end
+        ++ label lbl_nil
+        ++ print_value Tnil
+        ++ label lbl_end
+    | Tnil ->
+        leaq (lab Constants.format_nil_label) rax
+        ++ printf_rax Constants.format_string_label
+    | Tmap (k, v) ->
+        (* map[k1:v1 k2:v2 ...] in the order of the keys; the map, its
+           sorted slots and the index of the current one are kept on the
+           stack, with the current slot above them while it is printed *)
+        let lbl_loop = CompilationUtils.new_label () in
+        let lbl_first = CompilationUtils.new_label () in
+        let lbl_test = CompilationUtils.new_label () in
+        let lbl_nil = CompilationUtils.new_label () in
+        pushq (reg rax)
+        ++ print_string "map["
+        ++ popq rax
+        ++ testq (reg rax) (reg rax)
+        ++ jz lbl_nil
+        ++ pushq (reg rax)
+        ++ movq (reg rax) (reg rdi)
+        ++ call Constants.function_map_sorted_label
+        ++ pushq (reg rax)
+        ++ pushq (imm 0)
+        ++ jmp lbl_test
+        ++ label lbl_loop
+        ++ cmpq (imm 0) (ind rsp)
+        ++ je lbl_first
+        ++ print_string " "
+        ++ label lbl_first
+        ++ movq (ind rsp) (reg rax)
+        ++ movq (ind ~ofs:8 rsp) (reg rcx)
+        ++ movq (ind ~index:rax ~scale:8 rcx) (reg rax)
+        ++ pushq (reg rax)
+        ++ movq (ind ~ofs:24 rsp) (reg rcx)
+        ++ movq (ind ~ofs:16 rcx) (reg rcx)
+        ++ movq (ind ~index:rax ~scale:8 rcx) (reg rax)
+        ++ print_value k
+        ++ print_string ":"
+        ++ movq (ind rsp) (reg rax)
+        ++ movq (ind ~ofs:24 rsp) (reg rcx)
+        ++ imulq (ind ~ofs:40 rcx) (reg rax)
+        ++ addq (ind ~ofs:24 rcx) (reg rax)
+        ++ (if is_aggregate v then nop else movq (ind rax) (reg rax))
+        ++ print_value v
+        ++ popq rax
+        ++ incq (ind rsp)
+        ++ label lbl_test
+        ++ movq (ind rsp) (reg rax)
+        ++ movq (ind ~ofs:16 rsp) (reg rcx)
+        ++ cmpq (ind rcx) (reg rax)
+        ++ jl lbl_loop
+        ++ addq (imm 24) (reg rsp)
+        ++ label lbl_nil
+        ++ print_string "]"
+    | _ -> failwith "Unsupported type for print"
+
+  (* [e1 e2 ... en], for the rcx elements of type t at the address in rax;
+     the number of elements is kept at 16(%rsp), their address at 8(%rsp)
+     and the index of the current one at 0(%rsp) *)
+  and print_elements (t : typ) : text =
+    let lbl_loop = CompilationUtils.new_label () in
+    let lbl_first = CompilationUtils.new_label () in
+    let lbl_test = CompilationUtils.new_label () in
+    pushq (reg rcx)
+    ++ pushq (reg rax)
+    ++ pushq (imm 0)
+    ++ print_string "["
+    ++ jmp lbl_test
+    ++ label lbl_loop
+    ++ cmpq (imm 0) (ind rsp)
+    ++ je lbl_first
+    ++ print_string " "
+    ++ label lbl_first
+    ++ movq (ind rsp) (reg rax)
+    ++ imulq (imm (Allocation.sizeof t)) (reg rax)
+    ++ addq (ind ~ofs:8 rsp) (reg rax)
+    ++ (if is_aggregate t then nop else movq (ind rax) (reg rax))
+    ++ print_value t
+    ++ incq (ind rsp)
+    ++ label lbl_test
+    ++ movq (ind rsp) (reg rax)
+    ++ cmpq (ind ~ofs:16 rsp) (reg rax)
+    ++ jl lbl_loop
+    ++ addq (imm 24) (reg rsp)
+    ++ print_string "]"
 
   let print (compile_expr : expr -> text) (expr_list : expr list) : text =
     CompilationUtils.fold_left_concat
-      (fun e ->
-        compile_expr e
-        ++
-        match e.expr_typ with
-        (* first argument in rdi (format string), second in rsi (value)*)
-        | Tstring ->
-            leaq (lab Constants.format_string_label) rdi
-            ++ movq (reg rax) (reg rsi)
-            ++ call Constants.function_printf_label
-        | Tint ->
-            leaq (lab Constants.format_int_label) rdi
-            ++ movq (reg rax) (reg rsi)
-            ++ call Constants.function_printf_label
-        | Tbool ->
-            (* rax has 0 or 1 *)
-
-            (* labels for branches *)
-            let lbl_true = CompilationUtils.new_label () in
-            let lbl_end = CompilationUtils.new_label () in
-
-            (* compare bool with value 0 *)
-            cmpq (imm 0) (reg rax)
-            ++ jne lbl_true
-            ++
-            (* we want to put address of proper string to the rax register *)
-            (* case false *)
-            leaq (lab Constants.format_false_label) rax
-            ++ jmp lbl_end
-            ++
-            (* case true *)
-            label lbl_true
-            ++ leaq (lab Constants.format_true_label) rax
-            ++
-            (* rax has address of string to print *)
-            label lbl_end
-            ++ leaq (lab Constants.format_string_label) rdi
-            ++ movq (reg rax) (reg rsi)
-            ++ call Constants.function_printf_label
-        | _ -> failwith "Unsupported type for print")
+      (fun e -> compile_expr e ++ print_value ~top:true e.expr_typ)
       expr_list
 
+  (* the string of the integer of type typ in rax, written with digits *)
+  let integer_digits (typ : typ) (digits : string) : text =
+    let signed = match typ with Tinteger (_, false) -> 0 | _ -> 1 in
+    let bits = match String.length digits with 2 -> 1 | 8 -> 3 | _ -> 4 in
+    movq (reg rax) (reg rdi)
+    ++ movq (imm bits) (reg rsi)
+    ++ leaq (lab (StringTable.add digits)) rdx
+    ++ movq (imm signed) (reg rcx)
+    ++ call Constants.function_digits_label
+
+  (* the string in rax padded to width, see pad_; the zeros of a number
+     come after its sign *)
+  let pad (width : int) (padding : padding) ~(number : bool) : text =
+    let mode =
+      match padding with
+      | Pleft -> 0
+      | Pright -> 1
+      | Pzeros -> if number then 3 else 2
+    in
+    movq (reg rax) (reg rdi)
+    ++ movq (imm width) (reg rsi)
+    ++ movq (imm mode) (reg rdx)
+    ++ call Constants.function_pad_label
+
+  (* the string of a piece in rax *)
+  let rec piece (compile_expr : expr -> text) : format_piece -> text = function
+    | Fstring s -> leaq (lab (StringTable.add s)) rax
+    | Fverb (spec, e) ->
+        compile_expr e
+        ++ (match e.expr_typ with Tbool -> bool_to_string () | _ -> nop)
+        ++ movq (reg rax) (reg rsi)
+        ++ leaq (lab (StringTable.add spec)) rdi
+        ++ call Constants.function_format_label
+    | Fdigits (digits, e) -> compile_expr e ++ integer_digits e.expr_typ digits
+    | Ffloat e ->
+        compile_expr e
+        ++ movq (reg rax) (reg rdi)
+        ++ call Constants.function_format_float_label
+    | Fpad (width, padding, p) ->
+        let number =
+          match p with
+          | Fdigits _ | Ffloat _ | Fverb (_, { expr_typ = Tint | Tinteger _ })
+            ->
+              true
+          | _ -> false
+        in
+        piece compile_expr p ++ pad width padding ~number
+
+  (* format verbs were checked and translated to printf ones during typing;
+     a padded one is formatted in a string first *)
+  let printf (compile_expr : expr -> text) (pieces : format_piece list) : text
+      =
+    CompilationUtils.fold_left_concat
+      (function
+        | Fstring s ->
+            leaq (lab (StringTable.add s)) rax
+            ++ printf_rax Constants.format_string_label
+        | Fverb (spec, e) ->
+            compile_expr e
+            ++ (match e.expr_typ with Tbool -> bool_to_string () | _ -> nop)
+            ++ printf_rax (StringTable.add spec)
+        | Ffloat e ->
+            compile_expr e
+            ++ movq (reg rax) (reg rdi)
+            ++ call Constants.function_print_float_label
+        | (Fdigits _ | Fpad _) as p ->
+            piece compile_expr p ++ printf_rax Constants.format_string_label)
+      pieces
+
+  (* each verb is formatted in a string of its own, and the pieces are then
+     concatenated from left to right; the result is a fresh string, or the
+     empty one when there is nothing to format. As all the strings here, it
+     is a C string ended by a NUL byte, not a pointer and a length as in
+     Go, and len counts its bytes with strlen *)
+  let sprintf (compile_expr : expr -> text) (pieces : format_piece list) :
+      text =
+    let piece = piece compile_expr in
+    match pieces with
+    | [] -> leaq (lab (StringTable.add "")) rax
+    | p :: pl ->
+        piece p
+        ++ CompilationUtils.fold_left_concat
+             (fun p ->
+               pushq (reg rax)
+               ++ piece p
+               ++ movq (reg rax) (reg rsi)
+               ++ popq rdi
+               ++ call Constants.function_concat_label)
+             pl
+
   let block (compile_expr : expr -> text) (expr_list : expr list) : text =
     CompilationUtils.fold_left_concat compile_expr expr_list
 
+  let if_ (compile_expr : expr -> text) (cond : expr) (then_e : expr)
+      (else_e : expr) : text =
+    let lbl_else = CompilationUtils.new_label () in
+    let lbl_end = CompilationUtils.new_label () in
+    (* compiled in source order, for the positions that a panic reports *)
+    let cond_code = compile_expr cond in
+    let then_code = compile_expr then_e in
+    cond_code
+    ++ cmpq (imm BoolOps.false_value) (reg rax)
+    ++ je lbl_else
+    ++ then_code
+    ++ jmp lbl_end
+    ++ label lbl_else
+    ++ compile_expr else_e
+    ++ label lbl_end
+
+  (* strings are compared by content: rax and rcx are replaced by *)
+  (* strcmp(rax, rcx) and 0, so that they can be compared as integers *)
+  let string_compare : text =
+    movq (reg rax) (reg rdi)
+    ++ movq (reg rcx) (reg rsi)
+    ++ call Constants.function_strcmp_label
+    ++ movslq (reg eax) rax
+    ++ xorq (reg rcx) (reg rcx)
+
+  (* compares rax with rcx and stores the boolean result in rax *)
+  let compare ~(strings : bool) (setcc : [ `B ] operand -> text) : text =
+    (if strings then string_compare else nop)
+    ++ cmpq (reg rcx) (reg rax)
+    ++ setcc (reg (register8 rax))
+    ++ movzbq (reg (register8 rax)) rax
+
+  (* float64 values are kept as their bits in general purpose registers *)
+  (* and moved to xmm0 (first operand) and xmm1 (second one) to compute *)
+  let float_binop (op : Tast.binop) : text =
+    let arith instr =
+      movq_to_xmm rax xmm0 ++ movq_to_xmm rcx xmm1 ++ instr xmm1 xmm0
+      ++ movq_of_xmm xmm0 rax
+    in
+    (* ucomisd a b sets the flags like an unsigned comparison b - a *)
+    let compare a b setcc =
+      movq_to_xmm rax xmm0 ++ movq_to_xmm rcx xmm1 ++ ucomisd a b
+      ++ setcc (reg (register8 rax))
+      ++ movzbq (reg (register8 rax)) rax
+    in
+    (* NaN is different from everything, including itself *)
+    let equal setcc setparity combine =
+      movq_to_xmm rax xmm0 ++ movq_to_xmm rcx xmm1 ++ ucomisd xmm1 xmm0
+      ++ setcc (reg (register8 rax))
+      ++ setparity (reg (register8 rcx))
+      ++ combine (reg (register8 rcx)) (reg (register8 rax))
+      ++ movzbq (reg (register8 rax)) rax
+    in
+    match op with
+    | Badd -> arith addsd
+    | Bsub -> arith subsd
+    | Bmul -> arith mulsd
+    | Bdiv -> arith divsd
+    | Bgt -> compare xmm1 xmm0 seta
+    | Bge -> compare xmm1 xmm0 setae
+    | Blt -> compare xmm0 xmm1 seta
+    | Ble -> compare xmm0 xmm1 setae
+    | Beq -> equal sete setnp andb
+    | Bne -> equal setne setp orb
+    | Bmod | Band | Bor | Bbitand | Bbitor | Bxor | Bandnot | Bshl | Bshr ->
+        failwith "not a float64 operator"
+
+  (* rax << rcx or rax >> rcx, for a count of type count: a negative one is
+     a run-time error, and one of 64 or more shifts out every bit, while
+     the instructions only keep its lowest 6 bits *)
+  let shift (op : Tast.binop) (typ : typ) (count : typ) : text =
+    let lbl_shift = CompilationUtils.new_label () in
+    let lbl_end = CompilationUtils.new_label () in
+    let signed = match typ with Tinteger (_, false) -> false | _ -> true in
+    let check_count =
+      match count with
+      | Tinteger (_, false) -> nop
+      | _ ->
+          let lbl_count = CompilationUtils.new_label () in
+          testq (reg rcx) (reg rcx)
+          ++ jns lbl_count
+          ++ runtime_error "negative shift amount"
+          ++ label lbl_count
+    in
+    check_count
+    ++ cmpq (imm 63) (reg rcx)
+    ++ jbe lbl_shift
+    ++ (match op with
+       (* only the sign is left *)
+       | Bshr when signed -> movq (imm 63) (reg rcx)
+       | _ -> xorq (reg rax) (reg rax) ++ jmp lbl_end)
+    ++ label lbl_shift
+    ++ (match op with
+       | Bshl -> shlq_cl (reg rax)
+       | _ when signed -> sarq_cl (reg rax)
+       | _ -> shrq_cl (reg rax))
+    ++ label lbl_end
+
+  (* computes rax op rcx in rax, for operands of type typ; the count of a
+     shift has its own type *)
+  let rec apply_binop ?(count = Tint) (op : Tast.binop) (typ : typ) : text =
+    let compare = compare ~strings:(typ = Tstring) in
+    let unsigned = match typ with Tinteger (_, false) -> true | _ -> false in
+    match op with
+    | _ when typ = Tfloat -> float_binop op
+    | (Bdiv | Bmod) when typ = Tinteger (64, false) ->
+        (* narrower unsigned values are divided as ints, they are positive;
+           here the dividend is extended with zeros in rdx:rax *)
+        let lbl_div = CompilationUtils.new_label () in
+        testq (reg rcx) (reg rcx)
+        ++ jnz lbl_div
+        ++ runtime_error "integer divide by zero"
+        ++ label lbl_div
+        ++ xorq (reg rdx) (reg rdx)
+        ++ divq (reg rcx)
+        ++ (if op = Bmod then movq (reg rdx) (reg rax) else nop)
+    | (Badd | Bsub | Bmul | Bdiv | Bmod | Bshl)
+      when (match typ with Tinteger _ -> true | _ -> false) ->
+        apply_binop ~count op Tint ++ wrap typ
+    | Badd when typ = Tstring ->
+        movq (reg rax) (reg rdi)
+        ++ movq (reg rcx) (reg rsi)
+        ++ call Constants.function_concat_label
+    (* int is 64-bit and wraps around on overflow (two's complement), as in
+       Go; only constant expressions are checked, by the type checker *)
+    | Badd -> addq (reg rcx) (reg rax)
+    | Bsub -> subq (reg rcx) (reg rax)
+    | Bmul -> imulq (reg rcx) (reg rax)
+    | Bdiv | Bmod ->
+        (* idivq traps on min_int / -1, which has to wrap around to min_int *)
+        (* so a division by -1 is done as a negation (and x % -1 is 0) *)
+        let lbl_check = CompilationUtils.new_label () in
+        let lbl_div = CompilationUtils.new_label () in
+        let lbl_end = CompilationUtils.new_label () in
+        testq (reg rcx) (reg rcx)
+        ++ jnz lbl_check
+        ++ runtime_error "integer divide by zero"
+        ++ label lbl_check
+        ++ cmpq (imm (-1)) (reg rcx)
+        ++ jne lbl_div
+        ++ (if op = Bmod then xorq (reg rax) (reg rax) else negq (reg rax))
+        ++ jmp lbl_end
+        ++ label lbl_div
+        (* dividend has to be in rdx:rax (128 bit) *)
+        (* quotient - rax, remainder - rdx *)
+        ++ cqto
+        ++ idivq (reg rcx)
+        (* move remainder to rax if mod operation *)
+        ++ (if op = Bmod then movq (reg rdx) (reg rax) else nop)
+        ++ label lbl_end
+    | Beq -> compare sete
+    | Bne -> compare setne
+    | Blt -> compare (if unsigned then setb else setl)
+    | Ble -> compare (if unsigned then setbe else setle)
+    | Bgt -> compare (if unsigned then seta else setg)
+    | Bge -> compare (if unsigned then setae else setge)
+    (* the bits of two values of the same type are already extended *)
+    | Bbitand -> andq (reg rcx) (reg rax)
+    | Bbitor -> orq (reg rcx) (reg rax)
+    | Bxor -> xorq (reg rcx) (reg rax)
+    | Bandnot -> notq (reg rcx) ++ andq (reg rcx) (reg rax)
+    | Bshl | Bshr -> shift op typ count
+    | Band | Bor -> failwith "&& and || are compiled with short-circuit"
+
   let binop (compile_expr : expr -> text) (op : Tast.binop) (e1 : expr)
       (e2 : expr) : text =
-    (* save current stack pointer *)
-    movq (reg rsp) (reg r12)
-    ++
-    (* put first argument on the stack - pointed by rsp *)
-    (* second argument stays in rax *)
+    (* first operand is kept on the stack while the second one is computed *)
+    (* then first operand goes to rax and second one to rcx *)
     compile_expr e1
     ++ pushq (reg rax)
     ++ compile_expr e2
-    ++ (match op with
-      | Badd -> addq (ind ~ofs:0 rsp) (reg rax)
-      | Bsub -> subq (reg rax) (ind ~ofs:0 rsp) ++ popq rax
-      | Bmul -> imulq (ind ~ofs:0 rsp) (reg rax)
-      | Bdiv | Bmod ->
-          (* need to put divident into rdx:rax (128 bit) *)
-          (* divisor can be wherever - will put on the stack *)
-          (* quotient - rax, remainder - rdx *)
-          pushq (reg rax)
-          ++ movq (ind ~ofs:8 rsp) (reg rax)
-          ++ cqto
-          ++ idivq (ind ~ofs:0 rsp)
-          ++
-          (* move remainder to rax if mod operation *)
-          if op = Bmod then movq (reg rdx) (reg rax) else nop
-      | Beq ->
-          cmpq (reg rax) (ind ~ofs:0 rsp)
-          ++
-          (* Compare e1 vs e2 *)
-          sete (reg (register8 rax))
-          ++
-          (* %al = 1 if equal *)
-          movzbq (reg (register8 rax)) rax (* Zero-extend to 64-bit *)
-      | Bne ->
-          cmpq (reg rax) (ind ~ofs:0 rsp)
-          ++ setne (reg (register8 rax))
-          ++
-          (* %al = 1 if not equal *)
-          movzbq (reg (register8 rax)) rax
-      | Blt ->
-          cmpq (reg rax) (ind ~ofs:0 rsp)
-          ++
-          (* e1 - e2 *)
-          setl (reg (register8 rax))
-          ++
-          (* %al = 1 if e1 < e2 *)
-          movzbq (reg (register8 rax)) rax
-      | Ble ->
-          cmpq (reg rax) (ind ~ofs:0 rsp)
-          ++ setle (reg (register8 rax))
-          ++
-          (* %al = 1 if e1 <= e2 *)
-          movzbq (reg (register8 rax)) rax
-      | Bgt ->
-          cmpq (reg rax) (ind ~ofs:0 rsp)
-          ++ setg (reg (register8 rax))
-          ++
-          (* %al = 1 if e1 > e2 *)
-          movzbq (reg (register8 rax)) rax
-      | Bge ->
-          cmpq (reg rax) (ind ~ofs:0 rsp)
-          ++ setge (reg (register8 rax))
-          ++
-          (* %al = 1 if e1 >= e2 *)
-          movzbq (reg (register8 rax)) rax
-      | Band -> andq (ind ~ofs:0 rsp) (reg rax)
-      | Bor -> orq (ind ~ofs:0 rsp) (reg rax)) (* restore stack pointer *)
-    ++ movq (reg r12) (reg rsp)
+    ++ movq (reg rax) (reg rcx)
+    ++ popq rax
+    ++ apply_binop ~count:e2.expr_typ op e1.expr_typ
+
+  (* the second operand is evaluated only if the first one does not *)
+  (* determine the result, which is then already in rax *)
+  let short_circuit (compile_expr : expr -> text) (op : Tast.binop)
+      (e1 : expr) (e2 : expr) : text =
+    let lbl_end = CompilationUtils.new_label () in
+    let jump_if_decided = match op with Band -> je | _ -> jne in
+    compile_expr e1
+    ++ cmpq (imm BoolOps.false_value) (reg rax)
+    ++ jump_if_decided lbl_end
+    ++ compile_expr e2
+    ++ label lbl_end
+
+  let for_ (compile_expr : expr -> text) (cond : expr) (post : expr)
+      (body : expr) : text =
+    let lbl_head = CompilationUtils.new_label () in
+    let lbl_post = CompilationUtils.new_label () in
+    let lbl_end = CompilationUtils.new_label () in
+    (* the condition and the post statement are on the line of the for, the
+       body is compiled after them for the positions that a panic reports *)
+    let cond_code = compile_expr cond in
+    let post_code = compile_expr post in
+    LoopLabels.push
+      { LoopLabels.break_label = lbl_end; continue_label = lbl_post };
+    let body_code = compile_expr body in
+    LoopLabels.pop ();
+    label lbl_head
+    ++ cond_code
+    ++ cmpq (imm BoolOps.false_value) (reg rax)
+    ++ je lbl_end
+    ++ body_code
+    ++ label lbl_post
+    ++ post_code
+    ++ jmp lbl_head
+    ++ label lbl_end
+
+  (* the conditions are tested in source order, jumping to the body of the
+     first clause that holds, or else to the default one; the bodies are
+     laid out in source order too, so that fallthrough is just falling into
+     the next body *)
+  let switch_ (compile_expr : expr -> text) clauses : text =
+    let lbl_end = CompilationUtils.new_label () in
+    let clauses =
+      List.map (fun c -> (CompilationUtils.new_label (), c)) clauses
+    in
+    let test (lbl_body, (conds, _, _)) =
+      match conds with
+      | None -> nop
+      | Some conds ->
+          CompilationUtils.fold_left_concat
+            (fun cond ->
+              compile_expr cond
+              ++ cmpq (imm BoolOps.false_value) (reg rax)
+              ++ jne lbl_body)
+            conds
+    in
+    let otherwise =
+      match List.find_opt (function _, (None, _, _) -> true | _ -> false) clauses
+      with
+      | Some (lbl_body, _) -> jmp lbl_body
+      | None -> jmp lbl_end
+    in
+    let tests = CompilationUtils.fold_left_concat test clauses in
+    LoopLabels.push_switch lbl_end;
+    let bodies =
+      CompilationUtils.fold_left_concat
+        (fun (lbl_body, (_, body, fallthrough)) ->
+          label lbl_body ++ compile_expr body
+          ++ (if fallthrough then nop else jmp lbl_end))
+        clauses
+    in
+    LoopLabels.pop ();
+    tests ++ otherwise ++ bodies ++ label lbl_end
+
+  let call_function (compile_expr : expr -> text) (fn : function_)
+      (args : expr list) : text =
+    let n = List.length args in
+    (* arguments are evaluated from left to right and stored in a reserved *)
+    (* area so that the first one ends up at 16(%rbp) in the callee *)
+    subq (imm (8 * n)) (reg rsp)
+    ++ CompilationUtils.fold_left_concat
+         (fun (i, e) ->
+           compile_expr e ++ copy e.expr_typ
+           ++ movq (reg rax) (ind ~ofs:(8 * i) rsp))
+         (List.mapi (fun i e -> (i, e)) args)
+    ++ call (FunctionLabels.of_name fn.fn_name)
+    ++ addq (imm (8 * n)) (reg rsp)
+
+  (* a deferred call is recorded with the next one, the address of its
+     function, the number of its arguments and their values, computed now;
+     the most recent record is the first one *)
+  let defer_ (compile_expr : expr -> text) (fn : function_) (args : expr list)
+      : text =
+    let n = List.length args in
+    let store i e =
+      compile_expr e ++ copy e.expr_typ
+      ++ movq (ind rsp) (reg rcx)
+      ++ movq (reg rax) (ind ~ofs:(8 * (i + 3)) rcx)
+    in
+    allocate (8 * (n + 3))
+    ++ pushq (reg rax)
+    ++ CompilationUtils.fold_left_concat (fun x -> x) (List.mapi store args)
+    ++ popq rax
+    ++ movq (ind ~ofs:!Defers.slot rbp) (reg rcx)
+    ++ movq (reg rcx) (ind rax)
+    ++ leaq (lab (FunctionLabels.of_name fn.fn_name)) rcx
+    ++ movq (reg rcx) (ind ~ofs:8 rax)
+    ++ movq (imm n) (ind ~ofs:16 rax)
+    ++ movq (reg rax) (ind ~ofs:!Defers.slot rbp)
+
+  (* the returned value, if any, is passed in rax *)
+  let return (compile_expr : expr -> text) (exprs : expr list) : text =
+    (match exprs with
+    | [] -> nop
+    | [ e ] -> compile_expr e ++ copy e.expr_typ
+    | _ -> failwith "multiple results should have been rewritten")
+    ++ jmp !FunctionLabels.return_label
 
   let rec compile_expr (e : expr) : text =
     match e.expr_desc with
+    | TEskip -> nop
+    | TEline loc ->
+        Position.current := loc;
+        DebugInfo.line loc
+    | TEnil -> xorq (reg rax) (reg rax)
     | TEident v -> movq (ind ~ofs:v.v_ofs rbp) (reg rax)
     | TEconstant const -> constant const
     | TEunop (op, e) -> unop compile_expr op e
     | TEprint expr_list -> print compile_expr expr_list
+    | TEprintf pieces -> printf compile_expr pieces
+    | TEsprintf pieces -> sprintf compile_expr pieces
     | TEblock expr_list -> block compile_expr expr_list
+    | TEif (cond, then_e, else_e) -> if_ compile_expr cond then_e else_e
+    | TEbinop (((Band | Bor) as op), e1, e2) ->
+        short_circuit compile_expr op e1 e2
     | TEbinop (op, e1, e2) -> binop compile_expr op e1 e2
-    | TEvars _ -> nop
+    | TEvars var_list ->
+        (* variables are zero-initialized *)
+        CompilationUtils.fold_left_concat
+          (fun v -> zero v.v_typ ++ movq (reg rax) (ind ~ofs:v.v_ofs rbp))
+          (List.filter (fun v -> not (CompilationUtils.is_blank v)) var_list)
     | TEassign ([ left ], [ right ]) -> (
         compile_expr right
         ++
         match left.expr_desc with
+        | TEident v when CompilationUtils.is_blank v -> nop
+        | _ when is_aggregate left.expr_typ ->
+            (* the elements are copied into those of left *)
+            pushq (reg rax)
+            ++ (match left.expr_desc with
+               | TEindex ({ expr_typ = Tmap _ }, _) -> lvalue_address left
+               | _ -> compile_expr left)
+            ++ movq (reg rax) (reg rdi)
+            ++ popq rsi
+            ++ movq (imm (Allocation.sizeof left.expr_typ)) (reg rdx)
+            ++ call Constants.function_memmove_label
         | TEident v -> movq (reg rax) (ind ~ofs:v.v_ofs rbp)
-        | TEdot (struct_expr, field) ->
+        | _ ->
             pushq (reg rax)
-            ++ (match struct_expr.expr_desc with
-              | TEunop (Ustar, e) -> compile_expr e
-              | _ -> compile_expr struct_expr)
-            ++ addq
-                 (imm (Allocation.get_field_offset struct_expr.expr_typ field))
-                 (reg rax)
+            ++ lvalue_address left
             ++ popq rcx
-            ++ movq (reg rcx) (ind ~ofs:0 rax)
-        | TEunop (Ustar, e) ->
-            pushq (reg rax)
-            ++ compile_expr e ++ popq rcx
-            ++ movq (reg rcx) (ind ~ofs:0 rax)
-        | _ -> failwith "assignment not yet implemented")
+            ++ movq (reg rcx) (ind ~ofs:0 rax))
     | TEassign _ -> failwith "Unsupported assignment"
-    | TEdot (e, field) -> (
-        match e.expr_desc with
-        | TEunop (Ustar, ptr_expr) ->
-            compile_expr ptr_expr
-            ++ movq
-                 (ind ~ofs:(Allocation.get_field_offset e.expr_typ field) rax)
-                 (reg rax)
-        | _ -> compile_expr e ++ movq (ind ~ofs:field.f_ofs rax) (reg rax))
-    | TEnew ty ->
-        let size = Allocation.sizeof ty in
-        movq (imm size) (reg rdi) ++ call Constants.function_malloc_label
+    | TEincdec (left, op) when left.expr_typ <> Tint ->
+        let one =
+          match left.expr_typ with
+          | Tfloat -> { expr_desc = TEconstant (Cfloat 1.0); expr_typ = Tfloat }
+          | t -> { expr_desc = TEconstant (Cint 1L); expr_typ = t }
+        in
+        let op = if op = Inc then Badd else Bsub in
+        compile_expr { e with expr_desc = TEopassign (op, left, one) }
+    | TEincdec (left, Inc) -> lvalue_address left ++ incq (ind rax)
+    | TEincdec (left, Dec) -> lvalue_address left ++ decq (ind rax)
+    | TEopassign (op, left, right) ->
+        (* the address of left is kept on the stack while right is computed *)
+        lvalue_address left
+        ++ pushq (reg rax)
+        ++ compile_expr right
+        ++ movq (reg rax) (reg rcx)
+        ++ movq (ind rsp) (reg rax)
+        ++ movq (ind rax) (reg rax)
+        ++ apply_binop ~count:right.expr_typ op left.expr_typ
+        ++ popq rcx
+        ++ movq (reg rax) (ind rcx)
+    | TEfor (cond, post, body) -> for_ compile_expr cond post body
+    | TEswitch clauses -> switch_ compile_expr clauses
+    | TEcall (fn, args) -> call_function compile_expr fn args
+    | TEreturn exprs -> return compile_expr exprs
+    | TEbreak -> jmp (LoopLabels.innermost ()).LoopLabels.break_label
+    | TEcontinue -> jmp (LoopLabels.innermost ()).LoopLabels.continue_label
+    | TElabel l -> label (FunctionLabels.of_goto l)
+    | TEgoto l -> jmp (FunctionLabels.of_goto l)
+    | TEdot _ when is_aggregate e.expr_typ -> lvalue_address e
+    | TEdot _ -> lvalue_address e ++ movq (ind rax) (reg rax)
+    | TEstruct fields -> struct_literal compile_expr e.expr_typ fields
+    | TEnew ty -> allocate (Allocation.sizeof ty) ++ empty_strings ty
+    | TEindex (({ expr_typ = Tmap _ } as m), k) ->
+        map_index compile_expr m k e.expr_typ
+    | TEindex (a, i) when is_aggregate e.expr_typ -> element_address compile_expr a i
+    | TEindex (a, i) ->
+        element_address compile_expr a i ++ movq (ind rax) (reg rax)
+    | TEarray el -> (
+        match e.expr_typ with
+        | Tslice t -> xorq (reg rax) (reg rax) ++ append compile_expr t el
+        | t -> array_literal compile_expr t el)
+    | TElen e -> (
+        compile_expr e
+        ++
+        match e.expr_typ with
+        | Tstring ->
+            movq (reg rax) (reg rdi) ++ call Constants.function_strlen_label
+        | Tarray (_, n) | Tptr (Tarray (_, n)) -> movq (imm n) (reg rax)
+        | Tmap _ ->
+            let lbl_nil = CompilationUtils.new_label () in
+            testq (reg rax) (reg rax)
+            ++ jz lbl_nil
+            ++ movq (ind rax) (reg rax)
+            ++ label lbl_nil
+        | _ -> slice_header rax rcx ++ movq (reg rcx) (reg rax))
+    | TEmap entries -> map_literal compile_expr e.expr_typ entries
+    | TEconvert e1 -> convert compile_expr e.expr_typ e1
+    | TEcontains (m, k) ->
+        map_call compile_expr Constants.function_map_lookup_label m k
+        ++ testq (reg rax) (reg rax)
+        ++ setne (reg al)
+        ++ movzbq (reg al) rax
+    | TEdelete (m, k) ->
+        map_call compile_expr Constants.function_map_delete_label m k
+    | TEpanic e1 ->
+        compile_expr e1 ++ movq (reg rax) (reg rdi) ++ panic ()
+    | TEexit e1 ->
+        compile_expr e1 ++ movq (reg rax) (reg rdi)
+        ++ call Constants.function_exit_label
+    | TEargs -> leaq (lab Constants.args_label) rax
+    | TEdefer { expr_desc = TEcall (fn, args) } -> defer_ compile_expr fn args
+    | TEappend (s, el) -> (
+        match s.expr_typ with
+        | Tslice t -> compile_expr s ++ append compile_expr t el
+        | _ -> failwith "append to a non-slice")
     | _ -> failwith "Unsupported expression type"
 
+  (* puts the address of a left value in rax *)
+  and lvalue_address (e : expr) : text =
+    match e.expr_desc with
+    | TEident v -> leaq (ind ~ofs:v.v_ofs rbp) rax
+    (* the structure is the address of its fields, also through a pointer *)
+    | TEdot (({ expr_typ = Tptr _ } as struct_expr), field) ->
+        compile_expr struct_expr
+        ++ nil_check ()
+        ++ addq
+             (imm (Allocation.get_field_offset struct_expr.expr_typ field))
+             (reg rax)
+    | TEdot (struct_expr, field) ->
+        compile_expr struct_expr
+        ++ addq
+             (imm (Allocation.get_field_offset struct_expr.expr_typ field))
+             (reg rax)
+    | TEunop (Ustar, e) -> compile_expr e ++ nil_check ()
+    | TEindex (({ expr_typ = Tmap _ } as m), k) ->
+        map_element_address compile_expr m k e.expr_typ
+    | TEindex (a, i) -> element_address compile_expr a i
+    | _ -> failwith "not a left value"
+
   let compile_function (fn : function_) (body : expr) : text =
     let local_stack_size = Allocation.allocate_function fn body in
+    let epilogue = FunctionLabels.epilogue_of_name fn.fn_name in
+    FunctionLabels.return_label := epilogue;
+    Position.function_name := fn.fn_name;
+    Position.current := fn.fn_loc;
+    let defers = Defers.occur body in
+    let frame_size =
+      if defers then local_stack_size + 8 else local_stack_size
+    in
+    Defers.slot := -frame_size;
+    let body_code = compile_expr body in
 
-    label fn.fn_name
+    label (FunctionLabels.of_name fn.fn_name)
+    ++ DebugInfo.line fn.fn_loc
     ++ pushq (reg rbp)
     ++ movq (reg rsp) (reg rbp)
-    ++ subq (imm local_stack_size) (reg rsp)
-    ++ compile_expr body ++ leave ++ ret
+    ++ subq (imm frame_size) (reg rsp)
+    ++ (if fn.fn_name = "main" then store_args () else nop)
+    ++ (if defers then movq (imm 0) (ind ~ofs:(-frame_size) rbp) else nop)
+    ++ body_code ++ label epilogue
+    (* every return comes here, the deferred calls keep its value *)
+    ++ (if defers then
+          pushq (reg rax)
+          ++ movq (ind ~ofs:(-frame_size) rbp) (reg rdi)
+          ++ call Constants.function_run_defers_label
+          ++ popq rax
+        else nop)
+    ++
+    (* main exits with status 0 *)
+    (if fn.fn_name = "main" then xorq (reg rax) (reg rax) else nop)
+    ++ leave ++ ret
 end
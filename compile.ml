@@ -10,8 +10,14 @@ let debug = ref false
 let iter f = List.fold_left (fun code x -> code ++ f x) nop
 let iter2 f = List.fold_left2 (fun code x y -> code ++ f x y) nop
 
-let file ?debug:(b = false) (dl : Tast.tfile) : X86_64.program =
+let file ?debug:(b = false) ?(line_table = false) ?(optimize = false) ?source
+    (dl : Tast.tfile) : X86_64.program =
   debug := b;
+  DebugInfo.enabled := line_table;
+  DebugInfo.source := source;
+
+  (* labels of string constants are known before compiling the code *)
+  Data.collect_strings dl;
 
   (* compile functions *)
   let funcs =
@@ -23,13 +29,27 @@ let file ?debug:(b = false) (dl : Tast.tfile) : X86_64.program =
         | _ -> assert false)
       nop dl
   in
+  let files = DebugInfo.file_directives () in
 
+  (* the auxiliary functions come first, so that the line table does not
+     ascribe their code to the last statement of the program *)
+  let text =
+    files ++ globl "main"
+    ++ inline "\n# TODO some auxiliary assembly functions, if needed\n"
+    ++ aligned_call_wrapper ~f:"malloc" ~newf:"malloc_"
+    ++ aligned_call_wrapper ~f:"calloc" ~newf:"calloc_"
+    ++ aligned_call_wrapper ~f:"printf" ~newf:"printf_"
+    ++ aligned_call_wrapper ~f:"strcmp" ~newf:"strcmp_"
+    ++ aligned_call_wrapper ~f:"strlen" ~newf:"strlen_"
+    ++ aligned_call_wrapper ~f:"memmove" ~newf:"memmove_"
+    ++ aligned_call_wrapper ~f:"exit" ~newf:"exit_"
+    ++ Runtime.format_float ++ Runtime.print_float ++ Runtime.format
+    ++ Runtime.concat ++ Runtime.rune_string ++ Runtime.digits ++ Runtime.pad
+    ++ Runtime.panic ++ Runtime.run_defers ++ Runtime.index_error
+    ++ Runtime.append ++ Runtime.map
+    ++ funcs
+  in
   {
-    text =
-      globl "main" ++ funcs
-      ++ inline "\n# TODO some auxiliary assembly functions, if needed\n"
-      ++ aligned_call_wrapper ~f:"malloc" ~newf:"malloc_"
-      ++ aligned_call_wrapper ~f:"calloc" ~newf:"calloc_"
-      ++ aligned_call_wrapper ~f:"printf" ~newf:"printf_";
-    data = Data.generate_data_section dl;
+    text = (if optimize then Peephole.text text else text);
+    data = Data.generate_data_section ();
   }
@@ -0,0 +1,93 @@
+(** Constant folding, enabled with --fold.
+
+    After type checking, operations whose operands are constants are
+    replaced by their value, so that no code is emitted to compute them.
+    Nothing that may have an effect is folded: function calls are kept,
+    and divisions by a constant zero have already been rejected by the
+    type checker. *)
+
+open Lib
+open Tast
+module ConstEval = Typing_expr.ConstEval
+
+(* constant expressions were checked for overflows during type checking *)
+let loc = Typing_error.dummy_loc
+
+let rec expr e =
+  let mk d = { e with expr_desc = d } in
+  match e.expr_desc with
+  | TEskip | TEnil | TEconstant _ | TEtyped _ | TEexact _ | TEbreak | TEcontinue
+  | TEnew _ | TEident _ | TEvars _ | TEline _ | TElabel _ | TEgoto _ | TEargs ->
+      e
+  | TEbinop (op, e1, e2) -> binop e op (expr e1) (expr e2)
+  | TEunop (op, e1) -> (
+      let e1 = expr e1 in
+      match e1.expr_desc with
+      | TEconstant c ->
+          constant e (ConstEval.unop ~loc e.expr_typ op c) (TEunop (op, e1))
+      | _ -> mk (TEunop (op, e1)))
+  | TEcall (f, el) -> mk (TEcall (f, exprs el))
+  | TEdot (e1, f) -> mk (TEdot (expr e1, f))
+  | TEindex (e1, e2) -> mk (TEindex (expr e1, expr e2))
+  | TEarray el -> mk (TEarray (exprs el))
+  | TEstruct fl -> mk (TEstruct (List.map (fun (f, e) -> (f, expr e)) fl))
+  | TEmap kvl -> mk (TEmap (List.map (fun (k, v) -> (expr k, expr v)) kvl))
+  | TEcontains (e1, e2) -> mk (TEcontains (expr e1, expr e2))
+  | TEdelete (e1, e2) -> mk (TEdelete (expr e1, expr e2))
+  | TElen e1 -> mk (TElen (expr e1))
+  | TEconvert e1 -> mk (TEconvert (expr e1))
+  | TEappend (e1, el) -> mk (TEappend (expr e1, exprs el))
+  | TEpanic e1 -> mk (TEpanic (expr e1))
+  | TEexit e1 -> mk (TEexit (expr e1))
+  | TEdefer e1 -> mk (TEdefer (expr e1))
+  | TEassign (lvl, el) -> mk (TEassign (exprs lvl, exprs el))
+  | TEif (e1, e2, e3) -> mk (TEif (expr e1, expr e2, expr e3))
+  | TEreturn el -> mk (TEreturn (exprs el))
+  | TEblock bl -> mk (TEblock (exprs bl))
+  | TEfor (e1, e2, e3) -> mk (TEfor (expr e1, expr e2, expr e3))
+  | TEswitch clauses ->
+      let clause (conds, body, fallthrough) =
+        (option_map exprs conds, expr body, fallthrough)
+      in
+      mk (TEswitch (List.map clause clauses))
+  | TEprint el -> mk (TEprint (exprs el))
+  | TEprintf pl -> mk (TEprintf (pieces pl))
+  | TEsprintf pl -> mk (TEsprintf (pieces pl))
+  | TEincdec (e1, op) -> mk (TEincdec (expr e1, op))
+  | TEopassign (op, e1, e2) -> mk (TEopassign (op, expr e1, expr e2))
+
+(* a constant left operand of && or || decides whether the right one is
+   evaluated, as it would at run time *)
+and binop e op e1 e2 =
+  match (op, e1.expr_desc, e2.expr_desc) with
+  | Band, TEconstant (Cbool false), _ | Bor, TEconstant (Cbool true), _ -> e1
+  | Band, TEconstant (Cbool true), _ | Bor, TEconstant (Cbool false), _ -> e2
+  | _, TEconstant c1, TEconstant c2 ->
+      constant e
+        (ConstEval.binop ~loc e1.expr_typ op c1 c2)
+        (TEbinop (op, e1, e2))
+  | _ -> { e with expr_desc = TEbinop (op, e1, e2) }
+
+(* the value of [e] if it could be computed, [default] otherwise *)
+and constant e c default =
+  match c with
+  | Some c -> { e with expr_desc = TEconstant c }
+  | None -> { e with expr_desc = default }
+
+and exprs el = List.map expr el
+
+and pieces pl =
+  let rec piece = function
+    | Fverb (spec, e) -> Fverb (spec, expr e)
+    | Fdigits (digits, e) -> Fdigits (digits, expr e)
+    | Ffloat e -> Ffloat (expr e)
+    | Fpad (width, padding, p) -> Fpad (width, padding, piece p)
+    | Fstring _ as p -> p
+  in
+  List.map piece pl
+
+let decl = function
+  | TDfunction (f, e) -> TDfunction (f, expr e)
+  | TDstruct _ as d -> d
+
+let file dl = List.map decl dl
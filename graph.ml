@@ -1,23 +1,41 @@
 open Ast
 module StringSet = Set.Make (String)
 
+(* the elements of an array are stored in the array itself *)
+let rec field_dependency (t : ptyp) : string option =
+  match t with
+  | PTident id
+    when id.id <> "int" && id.id <> "bool" && id.id <> "string"
+         && id.id <> "float64" ->
+      Some id.id
+  | PTarray (_, t) -> field_dependency t
+  | _ -> None
+
 let get_struct_dependencies (s : pstruct) : StringSet.t =
   List.fold_left
     (fun acc (f_ident, f_type) ->
-      match f_type with
-      | PTident id when id.id <> "int" && id.id <> "bool" && id.id <> "string"
-        ->
-          StringSet.add id.id acc
-      | _ -> acc)
+      match field_dependency f_type with
+      | Some id -> StringSet.add id acc
+      | None -> acc)
     StringSet.empty s.ps_fields
 
-let build_graph (structs : pstruct list) : (string, StringSet.t) Hashtbl.t =
-  let graph = Hashtbl.create (List.length structs) in
+(* type T U and type T = U hold a U, as the fields of a structure do *)
+let get_type_dependencies (t : ptype) : StringSet.t =
+  match field_dependency t.pt_typ with
+  | Some id -> StringSet.singleton id
+  | None -> StringSet.empty
+
+let build_graph (structs : pstruct list) (types : ptype list) :
+    (string, StringSet.t) Hashtbl.t =
+  let graph = Hashtbl.create (List.length structs + List.length types) in
   List.iter
     (fun s ->
       let deps = get_struct_dependencies s in
       Hashtbl.add graph s.ps_name.id deps)
     structs;
+  List.iter
+    (fun t -> Hashtbl.add graph t.pt_name.id (get_type_dependencies t))
+    types;
 
   graph
 
@@ -26,10 +44,12 @@ let detect_cycles (structs : pstruct list)
   let visited = ref StringSet.empty in
   let cycles = ref [] in
 
+  (* a cycle comes back to a name of the path; a name reached twice by
+     two paths holds no cycle, and is not explored again *)
   let rec dfs s_name path =
-    if StringSet.mem s_name !visited then
+    if List.mem s_name path then
       cycles := String.concat " -> " (List.rev (s_name :: path)) :: !cycles
-    else begin
+    else if not (StringSet.mem s_name !visited) then begin
       visited := StringSet.add s_name !visited;
 
       match Hashtbl.find_opt graph s_name with
@@ -39,7 +59,8 @@ let detect_cycles (structs : pstruct list)
     end
   in
 
-  (* iterate over all structs *)
+  (* iterate over all structs, the cycles of the declared types going
+     through one of them *)
   List.iter
     (fun s ->
       dfs s.ps_name.id [];
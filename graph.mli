@@ -7,8 +7,12 @@ module StringSet : Set.S with type elt = string
 (** Extract direct struct dependencies from a structure (non-pointer fields only) *)
 val get_struct_dependencies : pstruct -> StringSet.t
 
-(** Build dependency graph mapping struct names to their dependencies *)
-val build_graph : pstruct list -> (string, StringSet.t) Hashtbl.t
+(** Extract the dependency of a declared type on the type it holds by value *)
+val get_type_dependencies : ptype -> StringSet.t
+
+(** Build dependency graph mapping struct and declared type names to their
+    dependencies *)
+val build_graph : pstruct list -> ptype list -> (string, StringSet.t) Hashtbl.t
 
 (** Detect cycles in the dependency graph, returns list of cycle descriptions *)
 val detect_cycles : pstruct list -> (string, StringSet.t) Hashtbl.t -> string list
\ No newline at end of file
@@ -4,69 +4,173 @@ open Lexing
 open Lexer
 open Parser
 
-let usage = "usage: minigo [options] file.go"
+let usage = "usage: minigo [options] file.go..."
 
 let debug = ref false
 let parse_only = ref false
 let type_only = ref false
+let fold = ref false
+let optimize = ref false
+let peephole = ref ""
+let line_table = ref false
+let output = ref ""
+let stdout_asm = ref false
+let dump = ref ""
 
 let spec =
   [ "--debug", Arg.Set debug, "  runs in debug mode";
     "--parse-only", Arg.Set parse_only, "  stops after parsing";
     "--type-only", Arg.Set type_only, "  stops after typing";
+    "--fold", Arg.Set fold, "  folds constant expressions";
+    "-O", Arg.Set optimize,
+    "  removes redundant instructions from the assembly (peephole pass)";
+    "-peephole", Arg.Set_string peephole,
+    "<file.s>  prints the assembly of <file.s> as -O rewrites it, and stops";
+    "-g", Arg.Set line_table, "  emits a line table for debuggers";
+    "-o", Arg.Set_string output, "<file>  writes the assembly to <file>";
+    "-S", Arg.Set stdout_asm,
+    "  prints the assembly on the standard output instead, with the source \
+     line of each statement in a comment when -g is given; not with -o";
+    "-dump", Arg.Symbol ([ "tokens"; "ast"; "tast" ], (fun s -> dump := s)),
+    "  prints the tokens, the syntax trees or the typed tree, and stops";
   ]
 
-let file =
-  let file = ref None in
-  let set_file s =
+let files =
+  let files = ref [] in
+  let add_file s =
     if not (Filename.check_suffix s ".go") then
       raise (Arg.Bad "no .go extension");
-    file := Some s
+    files := s :: !files
   in
-  Arg.parse spec set_file usage;
-  match !file with Some f -> f | None -> Arg.usage spec usage; exit 1
+  Arg.parse spec add_file usage;
+  if !peephole <> "" then begin
+    let c = open_in_bin !peephole in
+    let s = really_input_string c (in_channel_length c) in
+    close_in c;
+    let lines = String.split_on_char '\n' s in
+    let lines =
+      match List.rev lines with "" :: l -> List.rev l | _ -> lines
+    in
+    List.iter print_endline (Peephole.optimize lines);
+    exit 0
+  end;
+  if !stdout_asm && !output <> "" then begin
+    eprintf "minigo: -S and -o cannot be used together@.";
+    Arg.usage spec usage;
+    exit 1
+  end;
+  match List.rev !files with [] -> Arg.usage spec usage; exit 1 | l -> l
 
 let debug = !debug
 let type_only = !type_only
 
-let report_loc (b,e) =
-  let l = b.pos_lnum in
-  let fc = b.pos_cnum - b.pos_bol in
-  let lc = e.pos_cnum - b.pos_bol in
-  eprintf "File \"%s\", line %d, characters %d-%d:\n" file l fc lc
+(* the contents of each file, to print the line of an error *)
+let sources = Hashtbl.create 8
 
 let () =
-  let c = open_in file in
-  let lb = Lexing.from_channel c in
-  try
-    let f = Parser.file Lexer.next_token lb in
+  List.iter (fun file ->
+    let c = open_in_bin file in
+    let s = really_input_string c (in_channel_length c) in
     close_in c;
-    if !parse_only then exit 0;
-    let f = Typing.file ~debug f in
-    if type_only then exit 0;
-    let f = Rewrite.file ~debug f in
-    if debug then eprintf "%a@." Pretty.file f;
-    let code = Compile.file ~debug f in
-    let c = open_out (Filename.chop_suffix file ".go" ^ ".s") in
+    Hashtbl.replace sources file s) files
+
+(* the line of [file] that starts at offset [bol] *)
+let source_line file bol =
+  let source = Hashtbl.find sources file in
+  let e = try String.index_from source bol '\n' with Not_found ->
+    String.length source in
+  String.sub source bol (e - bol)
+
+(* prints the message of an error with its position, followed by the
+   source line and a caret under the position; the column is counted in
+   UTF-8 characters, not bytes, and the tabulations before the caret are
+   kept so that it is aligned; an error without a file is reported on the
+   first one *)
+let report (b,_) msg =
+  let file = if b.pos_fname = "" then List.hd files else b.pos_fname in
+  if b.pos_cnum < 0 then eprintf "%s: %s@." file msg
+  else begin
+    let line = source_line file b.pos_bol in
+    let caret = Buffer.create 80 in
+    let col = ref 1 in
+    String.iteri (fun i c ->
+      if i < b.pos_cnum - b.pos_bol && Char.code c land 0xC0 <> 0x80 then begin
+        incr col;
+        Buffer.add_char caret (if c = '\t' then '\t' else ' ')
+      end) line;
+    eprintf "%s:%d:%d: %s\n%s\n%s^@." file b.pos_lnum !col msg
+      line (Buffer.contents caret)
+  end
+
+(* the stages of the compiler; [lb] is the buffer being lexed, to locate
+   the lexical and syntax errors *)
+let lb = ref (Lexing.from_string "")
+
+let lex file =
+  lb := Lexing.from_string (Hashtbl.find sources file);
+  Lexing.set_filename !lb file;
+  !lb
+
+let parse file = (file, Parser.file Lexer.next_token (lex file))
+
+let typecheck fl = Typing.file ~debug fl
+
+let generate f =
+  let f = Named.file f in
+  let f = if !fold then Fold.file f else f in
+  let f = Rewrite.file ~debug f in
+  if debug then eprintf "%a@." Pretty.file f;
+  let source =
+    if !stdout_asm then Some (fun b -> source_line b.pos_fname b.pos_bol)
+    else None
+  in
+  Compile.file ~debug ~line_table:!line_table ~optimize:!optimize ?source f
+
+(* next to the first file, by default, or on the standard output with -S *)
+let write code =
+  if !stdout_asm then X86_64.print_program std_formatter code
+  else begin
+    let file =
+      if !output <> "" then !output
+      else Filename.chop_suffix (List.hd files) ".go" ^ ".s"
+    in
+    let c = open_out file in
     let fmt = formatter_of_out_channel c in
     X86_64.print_program fmt code;
     close_out c
+  end
+
+(* all the files are parsed before any of them is typed, since each may use
+   the declarations of the others; a dump stops after its stage *)
+let () =
+  try
+    if !dump = "tokens" then begin
+      List.iter (fun file -> Pretty_ast.tokens std_formatter (lex file)) files;
+      exit 0
+    end;
+    let fl = List.map parse files in
+    if !dump = "ast" then begin
+      List.iter (fun (_, f) -> printf "%a@." Pretty_ast.file f) fl;
+      exit 0
+    end;
+    if !parse_only then exit 0;
+    let f = typecheck fl in
+    if !dump = "tast" then begin
+      printf "%a@." Pretty.file f;
+      exit 0
+    end;
+    if type_only then exit 0;
+    write (generate f)
   with
     | Lexer.Lexing_error s ->
-	report_loc (lexeme_start_p lb, lexeme_end_p lb);
-	eprintf "lexical error: %s\n@." s;
+	report (lexeme_start_p !lb, lexeme_end_p !lb) ("lexical error: " ^ s);
 	exit 1
     | Parser.Error | Parsing.Parse_error ->
-	report_loc (lexeme_start_p lb, lexeme_end_p lb);
-	eprintf "syntax error\n@.";
+	report (lexeme_start_p !lb, lexeme_end_p !lb) "syntax error";
 	exit 1
     | Typing_error.Error (l, msg) ->
-	report_loc l;
-	eprintf "error: %s\n@." msg;
+	report l msg;
 	exit 1
     | e ->
 	eprintf "Anomaly: %s\n@." (Printexc.to_string e);
 	exit 2
-
-
-
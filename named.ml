@@ -0,0 +1,128 @@
+(** Erasure of the named types.
+
+    A type declared by type T U is distinct from U only for the type
+    checker: it has the layout and the operations of its underlying type.
+    Before the code is generated, each named type is replaced by its
+    underlying type, in the expressions, the variables, the functions and
+    the fields of the structures, so that the later passes never see one;
+    a typed constant is then a constant as any other. *)
+
+open Lib
+open Tast
+
+(* the fields of the structures already erased, as a structure may refer
+   to itself through a pointer *)
+let visited = ref []
+
+(* the named types being erased: one that refers to itself through a
+   pointer, a slice or a map is unrolled twice, which is enough, as the
+   code of an expression only uses the sizes of the values its type refers
+   to; those they refer to in turn are reached by other expressions, of
+   their own types, and a pointer to an integer stands for them *)
+let unrolling = ref []
+
+let rec typ = function
+  | Tnamed (name, t) ->
+      if List.length (List.filter (( = ) name) !unrolling) >= 2 then Tptr Tint
+      else begin
+        unrolling := name :: !unrolling;
+        let t = typ (Lazy.force t) in
+        unrolling := List.tl !unrolling;
+        t
+      end
+  | Tptr t -> Tptr (typ t)
+  | Tarray (t, n) -> Tarray (typ t, n)
+  | Tslice t -> Tslice (typ t)
+  | Tmap (k, v) -> Tmap (typ k, typ v)
+  | Tmany tl -> Tmany (List.map typ tl)
+  | Tstruct s as t ->
+      structure s;
+      t
+  | (Tint | Tbool | Tstring | Tfloat | Tinteger _ | Tnil) as t -> t
+
+and structure s =
+  if not (List.memq s !visited) then begin
+    visited := s :: !visited;
+    List.iter (fun f -> f.f_typ <- typ f.f_typ) s.s_list
+  end
+
+let var v = v.v_typ <- typ v.v_typ
+
+let function_ f =
+  f.fn_typ <- List.map typ f.fn_typ;
+  List.iter var f.fn_params
+
+let rec expr e =
+  let desc =
+    match e.expr_desc with
+    | (TEskip | TEnil | TEconstant _ | TEbreak | TEcontinue | TEline _
+      | TElabel _ | TEgoto _ | TEargs) as d ->
+        d
+    | TEtyped c -> TEconstant c
+    | TEexact _ -> assert false (* never out of the type checker *)
+    | TEnew t -> TEnew (typ t)
+    | TEident v ->
+        var v;
+        TEident v
+    | TEvars vl ->
+        List.iter var vl;
+        TEvars vl
+    | TEbinop (op, e1, e2) -> TEbinop (op, expr e1, expr e2)
+    | TEunop (op, e1) -> TEunop (op, expr e1)
+    | TEcall (f, el) ->
+        function_ f;
+        TEcall (f, exprs el)
+    | TEdot (e1, f) -> TEdot (expr e1, f)
+    | TEindex (e1, e2) -> TEindex (expr e1, expr e2)
+    | TEarray el -> TEarray (exprs el)
+    | TEstruct fl -> TEstruct (List.map (fun (f, e) -> (f, expr e)) fl)
+    | TEmap kvl -> TEmap (List.map (fun (k, v) -> (expr k, expr v)) kvl)
+    | TEcontains (e1, e2) -> TEcontains (expr e1, expr e2)
+    | TEdelete (e1, e2) -> TEdelete (expr e1, expr e2)
+    | TElen e1 -> TElen (expr e1)
+    | TEconvert e1 -> TEconvert (expr e1)
+    | TEappend (e1, el) -> TEappend (expr e1, exprs el)
+    | TEpanic e1 -> TEpanic (expr e1)
+    | TEexit e1 -> TEexit (expr e1)
+    | TEdefer e1 -> TEdefer (expr e1)
+    | TEassign (lvl, el) -> TEassign (exprs lvl, exprs el)
+    | TEif (e1, e2, e3) -> TEif (expr e1, expr e2, expr e3)
+    | TEreturn el -> TEreturn (exprs el)
+    | TEblock bl -> TEblock (exprs bl)
+    | TEfor (e1, e2, e3) -> TEfor (expr e1, expr e2, expr e3)
+    | TEswitch clauses ->
+        let clause (conds, body, fallthrough) =
+          (option_map exprs conds, expr body, fallthrough)
+        in
+        TEswitch (List.map clause clauses)
+    | TEprint el -> TEprint (exprs el)
+    | TEprintf pl -> TEprintf (pieces pl)
+    | TEsprintf pl -> TEsprintf (pieces pl)
+    | TEincdec (e1, op) -> TEincdec (expr e1, op)
+    | TEopassign (op, e1, e2) -> TEopassign (op, expr e1, expr e2)
+  in
+  { expr_desc = desc; expr_typ = typ e.expr_typ }
+
+and exprs el = List.map expr el
+
+and pieces pl =
+  let rec piece = function
+    | Fverb (spec, e) -> Fverb (spec, expr e)
+    | Fdigits (digits, e) -> Fdigits (digits, expr e)
+    | Ffloat e -> Ffloat (expr e)
+    | Fpad (width, padding, p) -> Fpad (width, padding, piece p)
+    | Fstring _ as p -> p
+  in
+  List.map piece pl
+
+let decl = function
+  | TDfunction (f, e) ->
+      function_ f;
+      TDfunction (f, expr e)
+  | TDstruct s as d ->
+      structure s;
+      d
+
+let file dl =
+  visited := [];
+  List.map decl dl
@@ -0,0 +1,122 @@
+(** Peephole optimization of the assembly, enabled with -O.
+
+    The code generator emits each expression on its own, and leaves
+    sequences that do nothing, or nothing more than their neighbours: moves
+    of a register to itself, a value pushed and popped at once, stores
+    overwritten by the next instruction, or jumps to the label that follows.
+    The instructions are read one at a time, and each is compared with the
+    one before it, so that a removal exposes the next pair. Only two
+    instructions that follow each other are simplified: a label, a directive
+    or a comment between them stops the pass, as the code after a label
+    may be reached from elsewhere. *)
+
+open X86_64
+
+type line =
+  | Label of string
+  | Instr of { op : string; args : string list; text : string }
+      (** mnemonic, operands, and the line as it was written *)
+  | Other of string (** directives, comments and blank lines, kept as is *)
+
+let instr op args =
+  Instr { op; args; text = "\t" ^ op ^ " " ^ String.concat ", " args }
+
+(* the operands are separated by the commas outside of the parentheses of
+   an indirect address, as in 8(%rax,%rcx,8) *)
+let operands s =
+  let depth = ref 0 and start = ref 0 and args = ref [] in
+  String.iteri
+    (fun i c ->
+      match c with
+      | '(' -> incr depth
+      | ')' -> decr depth
+      | ',' when !depth = 0 ->
+          args := String.sub s !start (i - !start) :: !args;
+          start := i + 1
+      | _ -> ())
+    s;
+  let last = String.sub s !start (String.length s - !start) in
+  List.rev_map String.trim (last :: !args) |> List.filter (fun a -> a <> "")
+
+(* an instruction with a comment is left alone *)
+let parse s =
+  let t = String.trim s in
+  let n = String.length t in
+  if n = 0 then Other s
+  else if s.[0] <> '\t' && s.[0] <> ' ' && t.[n - 1] = ':' then
+    Label (String.sub t 0 (n - 1))
+  else if t.[0] = '.' || String.contains t '#' then Other s
+  else
+    (* the mnemonic ends at the first blank *)
+    let rec blank i =
+      if i = n || t.[i] = ' ' || t.[i] = '\t' then i else blank (i + 1)
+    in
+    let i = blank 0 in
+    let args = operands (String.sub t i (n - i)) in
+    Instr { op = String.sub t 0 i; args; text = s }
+
+let print = function
+  | Label l -> l ^ ":"
+  | Instr { text; _ } -> text
+  | Other s -> s
+
+let is_register a = a <> "" && a.[0] = '%'
+let is_immediate a = a <> "" && a.[0] = '$'
+
+(* a register is read by an operand that names it, as its base or index
+   when it is an address *)
+let mentions r a =
+  let n = String.length r in
+  let rec from i =
+    i + n <= String.length a && (String.sub a i n = r || from (i + 1))
+  in
+  from 0
+
+let is_jump op = op.[0] = 'j'
+
+(* the lines that replace [prev] followed by [cur], when they can be
+   simplified; moves and pushes leave the flags as they are *)
+let combine prev cur =
+  match (prev, cur) with
+  | ( Instr { op = "pushq"; args = [ x ]; _ },
+      Instr { op = "popq"; args = [ r ]; _ } )
+    when r <> "%rsp" && not (mentions "%rsp" x) ->
+      if x = r then Some [] else Some [ instr "movq" [ x; r ] ]
+  (* the first store is dead: nothing reads it before it is overwritten *)
+  | ( Instr { op = "movq"; args = [ a; b ]; _ },
+      Instr { op = "movq"; args = [ c; d ]; _ } )
+    when b = d && (is_register a || is_immediate a) && not (mentions b c) ->
+      Some [ cur ]
+  (* the value copied back is already there *)
+  | ( Instr { op = "movq"; args = [ a; b ]; _ },
+      Instr { op = "movq"; args = [ c; d ]; _ } )
+    when c = b && d = a
+         && ((is_register a && not (mentions a b))
+            || (is_register b && not (mentions b a))) ->
+      Some [ prev ]
+  | Instr { op; args = [ l ]; _ }, Label l' when is_jump op && l = l' ->
+      Some [ cur ]
+  | _ -> None
+
+let redundant = function
+  | Instr { op = "movq"; args = [ a; b ]; _ } -> a = b && is_register a
+  | _ -> false
+
+(* [stack] holds the optimized lines, the last one first *)
+let rec push stack line =
+  if redundant line then stack
+  else
+    match stack with
+    | prev :: rest -> (
+        match combine prev line with
+        | Some lines -> List.fold_left push rest lines
+        | None -> line :: stack)
+    | [] -> [ line ]
+
+let optimize (lines : string list) : string list =
+  List.fold_left (fun stack s -> push stack (parse s)) [] lines
+  |> List.rev_map print
+
+let text (code : text) : text =
+  let lines = optimize (lines code) in
+  inline (String.concat "" (List.map (fun s -> s ^ "\n") lines))
@@ -23,27 +23,43 @@ let binop = function
   | Bge -> ">="
   | Band -> "&&"
   | Bor -> "||"
+  | Bbitand -> "&"
+  | Bbitor -> "|"
+  | Bxor -> "^"
+  | Bandnot -> "&^"
+  | Bshl -> "<<"
+  | Bshr -> ">>"
 let unop = function
   | Ast.Uneg -> "-"
   | Unot -> "!"
   | Uamp -> "&"
   | Ustar -> "*"
+  | Ucompl -> "^"
 
 let rec typ fmt = function
   | Tint -> fprintf fmt "int"
+  | Tfloat -> fprintf fmt "float64"
+  | Tinteger (bits, signed) ->
+      fprintf fmt "%sint%d" (if signed then "" else "u") bits
   | Tbool -> fprintf fmt "bool"
   | Tstring -> fprintf fmt "string"
   | Tstruct s -> fprintf fmt "%s" s.s_name
   | Tptr ty -> fprintf fmt "*%a" typ ty
+  | Tarray (ty, n) -> fprintf fmt "[%d]%a" n typ ty
+  | Tslice ty -> fprintf fmt "[]%a" typ ty
+  | Tmap (k, v) -> fprintf fmt "map[%a]%a" typ k typ v
+  | Tnamed (name, _) -> fprintf fmt "%s" name
   | Tnil -> fprintf fmt "<Tnil>"
   | Tmany tyl -> fprintf fmt "<%a>" (print_list comma typ) tyl
 
 let rec expr fmt e = match e.expr_desc with
   | TEskip -> fprintf fmt ";"
   | TEnil -> fprintf fmt "ni"
-  | TEconstant (Cint n) -> fprintf fmt "%Ld" n
-  | TEconstant (Cbool b) -> fprintf fmt "%b" b
-  | TEconstant (Cstring s) -> fprintf fmt "%S" s
+  | TEconstant (Cint n) | TEtyped (Cint n) -> fprintf fmt "%Ld" n
+  | TEconstant (Cfloat f) | TEtyped (Cfloat f) -> fprintf fmt "%h" f
+  | TEconstant (Cbool b) | TEtyped (Cbool b) -> fprintf fmt "%b" b
+  | TEconstant (Cstring s) | TEtyped (Cstring s) -> fprintf fmt "%S" s
+  | TEexact b -> fprintf fmt "%s" (Bigint.to_string b)
   | TEbinop (op, e1, e2) ->
      fprintf fmt "@[(%a %s@ %a)@]" expr e1 (binop op) expr e2
   | TEunop (op, e1) ->
@@ -56,6 +72,34 @@ let rec expr fmt e = match e.expr_desc with
      fprintf fmt "%s" v.v_name
   | TEdot (e1, f) ->
      fprintf fmt "%a.%s" expr e1 f.f_name
+  | TEindex (e1, e2) ->
+     fprintf fmt "%a[%a]" expr e1 expr e2
+  | TEarray el ->
+     fprintf fmt "%a{%a}" typ e.expr_typ list el
+  | TEstruct fl ->
+     let field fmt (f, e) = fprintf fmt "%s: %a" f.f_name expr e in
+     fprintf fmt "%a{%a}" typ e.expr_typ (print_list comma field) fl
+  | TEmap kvl ->
+     let entry fmt (k, v) = fprintf fmt "%a: %a" expr k expr v in
+     fprintf fmt "%a{%a}" typ e.expr_typ (print_list comma entry) kvl
+  | TEcontains (e1, e2) ->
+     fprintf fmt "contains(%a, %a)" expr e1 expr e2
+  | TEdelete (e1, e2) ->
+     fprintf fmt "delete(%a, %a)" expr e1 expr e2
+  | TElen e1 ->
+     fprintf fmt "len(%a)" expr e1
+  | TEconvert e1 ->
+     fprintf fmt "%a(%a)" typ e.expr_typ expr e1
+  | TEappend (e1, el) ->
+     fprintf fmt "append(%a)" list (e1 :: el)
+  | TEpanic e1 ->
+     fprintf fmt "panic(%a)" expr e1
+  | TEexit e1 ->
+     fprintf fmt "os.Exit(%a)" expr e1
+  | TEargs ->
+     fprintf fmt "os.Args"
+  | TEdefer e1 ->
+     fprintf fmt "defer %a" expr e1
   | TEassign ([], _) | TEassign (_, []) ->
      assert false
   | TEassign ([lvl], [e]) ->
@@ -68,19 +112,55 @@ let rec expr fmt e = match e.expr_desc with
      fprintf fmt "return %a" list el
   | TEblock bl ->
      block fmt bl
-  | TEfor (e1, e2) ->
-     fprintf fmt "for %a %a" expr e1 expr e2
+  | TEfor (e1, e2, e3) ->
+     fprintf fmt "for %a; %a %a" expr e1 expr e2 expr e3
   | TEprint el ->
      fprintf fmt "fmt.Print(%a)" list el
+  | TEprintf pl ->
+     fprintf fmt "fmt.Printf(%a)" (print_list comma piece) pl
+  | TEsprintf pl ->
+     fprintf fmt "fmt.Sprintf(%a)" (print_list comma piece) pl
+  | TEopassign (op, e1, e2) ->
+     fprintf fmt "%a %s= %a" expr e1 (Utils.string_of_binop op) expr e2
   | TEincdec (e1, op) ->
      fprintf fmt "%a%s" expr e1 (match op with Inc -> "++" | Dec -> "--")
+  | TEbreak ->
+     fprintf fmt "break"
+  | TEcontinue ->
+     fprintf fmt "continue"
+  | TElabel l ->
+     fprintf fmt "%s:" l
+  | TEgoto l ->
+     fprintf fmt "goto %s" l
+  | TEswitch clauses ->
+     fprintf fmt "switch {@\n%a}" (print_list newline clause) clauses
   | TEvars vl ->
      fprintf fmt "var %a" (print_list comma var) vl
+  | TEline (b, _) ->
+     fprintf fmt "// line %d" b.Lexing.pos_lnum
+
+and piece fmt = function
+  | Fstring s -> fprintf fmt "%S" s
+  | Fverb (spec, e) -> fprintf fmt "%s:%a" spec expr e
+  | Fdigits (digits, e) -> fprintf fmt "%S:%a" digits expr e
+  | Ffloat e -> fprintf fmt "float:%a" expr e
+  | Fpad (width, padding, p) ->
+     let flag = match padding with Pleft -> "" | Pright -> "-" | Pzeros -> "0" in
+     fprintf fmt "%s%d(%a)" flag width piece p
+
+and clause fmt (conds, body, fallthrough) =
+  (match conds with
+   | None -> fprintf fmt "default: "
+   | Some el -> fprintf fmt "case %a: " list el);
+  fprintf fmt "%a%s" expr body (if fallthrough then " fallthrough" else "")
 
 and var fmt v =
   fprintf fmt "%s" v.v_name
 
+(* the positions of the statements are left out *)
 and block fmt bl =
+  let bl =
+    List.filter (function { expr_desc = TEline _ } -> false | _ -> true) bl in
   fprintf fmt "{@\n%a}" (print_list newline expr) bl
 
 and list fmt el =
@@ -0,0 +1,237 @@
+
+(** Mini Go pretty-printer for the tokens and the parsed syntax trees.
+
+  Prints the tokens as the lexer returns them, semicolons included, when
+  command line flag `-dump=tokens` is passed, and the program as the
+  parser understood it, in a syntax close to that of Go, with every binary
+  operation in parentheses, when `-dump=ast` is passed.
+*)
+
+open Lib
+open Format
+open Ast
+
+let unop = function
+  | Uneg -> "-"
+  | Unot -> "!"
+  | Uamp -> "&"
+  | Ustar -> "*"
+  | Ucompl -> "^"
+
+let constant fmt = function
+  | Cint n -> fprintf fmt "%Ld" n
+  | Cfloat f -> fprintf fmt "%h" f
+  | Cbool b -> fprintf fmt "%b" b
+  | Cstring s -> fprintf fmt "%S" s
+
+let token fmt t =
+  let open Parser in
+  match t with
+  | CST c -> fprintf fmt "CST %a" constant c
+  | IDENT s -> fprintf fmt "IDENT %s" s
+  | STRING s -> fprintf fmt "STRING %S" s
+  | RUNE n -> fprintf fmt "RUNE %Ld" n
+  | EOF -> fprintf fmt "EOF"
+  | PACKAGE -> fprintf fmt "package"
+  | IMPORT -> fprintf fmt "import"
+  | FUNC -> fprintf fmt "func"
+  | TYPE -> fprintf fmt "type"
+  | STRUCT -> fprintf fmt "struct"
+  | FOR -> fprintf fmt "for"
+  | IF -> fprintf fmt "if"
+  | ELSE -> fprintf fmt "else"
+  | RETURN -> fprintf fmt "return"
+  | BREAK -> fprintf fmt "break"
+  | CONTINUE -> fprintf fmt "continue"
+  | GOTO -> fprintf fmt "goto"
+  | SWITCH -> fprintf fmt "switch"
+  | CASE -> fprintf fmt "case"
+  | DEFAULT -> fprintf fmt "default"
+  | FALLTHROUGH -> fprintf fmt "fallthrough"
+  | DEFER -> fprintf fmt "defer"
+  | VAR -> fprintf fmt "var"
+  | CONST -> fprintf fmt "const"
+  | NIL -> fprintf fmt "nil"
+  | MAP -> fprintf fmt "map"
+  | LEFTPAR -> fprintf fmt "("
+  | RIGHTPAR -> fprintf fmt ")"
+  | LEFTBRACE -> fprintf fmt "{"
+  | RIGHTBRACE -> fprintf fmt "}"
+  | LEFTBRACKET -> fprintf fmt "["
+  | RIGHTBRACKET -> fprintf fmt "]"
+  | SEMICOLON -> fprintf fmt ";"
+  | COLON -> fprintf fmt ":"
+  | COMMA -> fprintf fmt ","
+  | DOT -> fprintf fmt "."
+  | ELLIPSIS -> fprintf fmt "..."
+  | AMP -> fprintf fmt "&"
+  | COLONEQ -> fprintf fmt ":="
+  | EQ -> fprintf fmt "="
+  | PLUSPLUS -> fprintf fmt "++"
+  | MINUSMINUS -> fprintf fmt "--"
+  | VERTICALBARVERTICALBAR -> fprintf fmt "||"
+  | AMPERSANDAMPERSAND -> fprintf fmt "&&"
+  | COMP op -> fprintf fmt "%s" (Utils.string_of_binop op)
+  | OPEQ op -> fprintf fmt "%s=" (Utils.string_of_binop op)
+  | PLUS -> fprintf fmt "+"
+  | MINUS -> fprintf fmt "-"
+  | STAR -> fprintf fmt "*"
+  | SLASH -> fprintf fmt "/"
+  | PERCENT -> fprintf fmt "%%"
+  | BAR -> fprintf fmt "|"
+  | CARET -> fprintf fmt "^"
+  | AMPCARET -> fprintf fmt "&^"
+  | SHL -> fprintf fmt "<<"
+  | SHR -> fprintf fmt ">>"
+  | BANG -> fprintf fmt "!"
+
+(* one token per line, after its position *)
+let tokens fmt lexbuf =
+  let rec loop () =
+    let t = Lexer.next_token lexbuf in
+    let b = Lexing.lexeme_start_p lexbuf in
+    fprintf fmt "%d:%d %a@\n" b.Lexing.pos_lnum (b.pos_cnum - b.pos_bol + 1)
+      token t;
+    match t with Parser.EOF -> () | _ -> loop ()
+  in
+  loop ()
+
+let ident fmt id =
+  fprintf fmt "%s" id.id
+
+let idents fmt idl =
+  print_list comma ident fmt idl
+
+let rec ptyp fmt = function
+  | PTident id -> ident fmt id
+  | PTptr ty -> fprintf fmt "*%a" ptyp ty
+  | PTarray (e, ty) -> fprintf fmt "[%a]%a" expr e ptyp ty
+  | PTslice ty -> fprintf fmt "[]%a" ptyp ty
+  | PTmap (k, v) -> fprintf fmt "map[%a]%a" ptyp k ptyp v
+
+and expr fmt e = match e.pexpr_desc with
+  | PEskip -> fprintf fmt ";"
+  | PEconstant c -> constant fmt c
+  | PErune n -> fprintf fmt "'\\U%08Lx'" n
+  | PEbinop (op, e1, e2) ->
+     fprintf fmt "@[(%a %s@ %a)@]"
+       expr e1 (Utils.string_of_binop op) expr e2
+  | PEunop (op, e1) ->
+     fprintf fmt "@[(%s%a)@]" (unop op) expr e1
+  | PEnil ->
+     fprintf fmt "nil"
+  | PEcall (f, el) ->
+     fprintf fmt "%s(%a)" f.id list el
+  | PEident id ->
+     ident fmt id
+  | PEdot (e1, f) ->
+     fprintf fmt "%a.%s" expr e1 f.id
+  | PEindex (e1, e2) ->
+     fprintf fmt "%a[%a]" expr e1 expr e2
+  | PEcomposite (ty, el) ->
+     let element fmt = function
+       | None, e -> expr fmt e
+       | Some k, e -> fprintf fmt "%a: %a" expr k expr e
+     in
+     fprintf fmt "%a{%a}" (pp_print_option ptyp) ty
+       (print_list comma element) el
+  | PEassign (lvl, el) ->
+     fprintf fmt "%a = %a" list lvl list el
+  | PEvars (idl, ty, el) ->
+     fprintf fmt "var %a%a%a" idents idl
+       (pp_print_option (fun fmt -> fprintf fmt " %a" ptyp)) ty
+       (fun fmt -> function [] -> () | el -> fprintf fmt " = %a" list el) el
+  | PEdefine (idl, el) ->
+     fprintf fmt "%a := %a" idents idl list el
+  | PEif (e1, e2, e3) ->
+     fprintf fmt "if %a %a else %a" expr e1 expr e2 expr e3
+  | PEreturn el ->
+     fprintf fmt "return %a" list el
+  | PEblock bl ->
+     block fmt bl
+  | PEfor (e1, e2, e3) ->
+     fprintf fmt "for ; %a; %a %a" expr e1 expr e2 expr e3
+  | PEincdec (e1, op) ->
+     fprintf fmt "%a%s" expr e1 (match op with Inc -> "++" | Dec -> "--")
+  | PEopassign (op, e1, e2) ->
+     fprintf fmt "%a %s= %a" expr e1 (Utils.string_of_binop op) expr e2
+  | PEbreak id ->
+     fprintf fmt "break%a" label id
+  | PEcontinue id ->
+     fprintf fmt "continue%a" label id
+  | PElabel (id, e1) ->
+     fprintf fmt "%s: %a" id.id expr e1
+  | PEgoto id ->
+     fprintf fmt "goto %s" id.id
+  | PEconsts cl ->
+     fprintf fmt "const (@[<v 2>@\n%a@]@\n)" (print_list newline const) cl
+  | PEswitch (tag, clauses) ->
+     fprintf fmt "switch %a {@\n%a}" (pp_print_option expr) tag
+       (print_list newline clause) clauses
+  | PEfallthrough ->
+     fprintf fmt "fallthrough"
+  | PEdefer e1 ->
+     fprintf fmt "defer %a" expr e1
+  | PEspread e1 ->
+     fprintf fmt "%a..." expr e1
+
+and const fmt c =
+  fprintf fmt "%a%a = %a // iota %d" idents c.pc_names
+    (pp_print_option (fun fmt -> fprintf fmt " %a" ptyp)) c.pc_typ
+    list c.pc_values c.pc_iota
+
+and clause fmt (conds, body) =
+  (match conds with
+   | None -> fprintf fmt "default: "
+   | Some el -> fprintf fmt "case %a: " list el);
+  expr fmt body
+
+and block fmt bl =
+  fprintf fmt "@[<v 2>{@\n%a@]@\n}" (print_list newline expr) bl
+
+and list fmt el =
+  print_list comma expr fmt el
+
+and label fmt = function
+  | None -> ()
+  | Some id -> fprintf fmt " %s" id.id
+
+let param fmt (id, ty) =
+  fprintf fmt "%s %a" id.id ptyp ty
+
+(* the last parameter of a variadic function is x ...T *)
+let params fmt f =
+  let rec loop fmt = function
+    | [] -> ()
+    | [ (id, PTslice ty) ] when f.pf_variadic ->
+        fprintf fmt "%s ...%a" id.id ptyp ty
+    | [ p ] -> param fmt p
+    | p :: pl -> fprintf fmt "%a, %a" param p loop pl
+  in
+  loop fmt f.pf_params
+
+let results fmt f =
+  match f.pf_results with
+  | [] -> fprintf fmt "(%a)" (print_list comma ptyp) f.pf_typ
+  | names -> fprintf fmt "(%a)" (print_list comma param)
+               (List.combine names f.pf_typ)
+
+let decl fmt = function
+  | PDfunction f ->
+     fprintf fmt "func %s(%a) %a %a@\n@\n" f.pf_name.id
+       params f results f expr f.pf_body
+  | PDstruct s ->
+     fprintf fmt "@[<v 2>type %s struct {@\n%a@]@\n}@\n@\n" s.ps_name.id
+       (print_list newline param) s.ps_fields
+  | PDtype t ->
+     fprintf fmt "type %s%s %a@\n@\n" t.pt_name.id
+       (if t.pt_alias then " =" else "") ptyp t.pt_typ
+  | PDconsts cl ->
+     let e = { pexpr_desc = PEconsts cl; pexpr_loc = Typing_error.dummy_loc } in
+     fprintf fmt "%a@\n@\n" expr e
+
+let file fmt ((imp, dl) : pfile) =
+  fprintf fmt "package main@\n@\n";
+  List.iter (fun p -> fprintf fmt "import %S@\n" p.id) imp;
+  if imp <> [] then fprintf fmt "@\n";
+  List.iter (decl fmt) dl
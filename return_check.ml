@@ -1,8 +1,73 @@
 open Tast
+open Typing_types
 
+(* a break leaving the enclosing switch or loop; nested loops and switches
+   catch their own *)
+let rec breaks (e : expr) : bool =
+  match e.expr_desc with
+  | TEbreak -> true
+  | TEblock exprs -> List.exists breaks exprs
+  | TEif (_, then_e, else_e) -> breaks then_e || breaks else_e
+  | _ -> false
+
+(* the labels defined in [e] *)
+let rec labels (e : expr) : string list =
+  match e.expr_desc with
+  | TElabel l -> [ l ]
+  | TEblock exprs -> List.concat_map labels exprs
+  | TEif (_, then_e, else_e) -> labels then_e @ labels else_e
+  | TEfor (_, _, body) -> labels body
+  | TEswitch clauses -> List.concat_map (fun (_, body, _) -> labels body) clauses
+  | _ -> []
+
+(* a break L leaving the enclosing switch or loop, even from a nested one;
+   it was made a goto to the end of the statement labeled L *)
+let breaks_label (body : expr) : bool =
+  let inner = labels body in
+  let rec goto (e : expr) =
+    match e.expr_desc with
+    | TEgoto l -> Constants.is_break_label l && not (List.mem l inner)
+    | TEblock exprs -> List.exists goto exprs
+    | TEif (_, then_e, else_e) -> goto then_e || goto else_e
+    | TEfor (_, _, body) -> goto body
+    | TEswitch clauses -> List.exists (fun (_, body, _) -> goto body) clauses
+    | _ -> false
+  in
+  goto body
+
+(* the positions of the statements and the empty ones are left aside, and
+   so is the label that a break L jumps to, after the statement labeled L *)
+let last_statement exprs =
+  List.find_opt
+    (fun e ->
+      match e.expr_desc with
+      | TEline _ | TEskip -> false
+      | TElabel l -> not (Constants.is_break_label l)
+      | _ -> true)
+    (List.rev exprs)
+
+(* a terminating statement, as defined by Go *)
 let rec always_returns (e : expr) : bool =
   match e.expr_desc with
-  | TEreturn _ -> true
-  | TEblock exprs -> List.exists always_returns exprs
+  | TEreturn _ | TEpanic _ | TEgoto _ -> true
+  | TEblock exprs -> (
+      match last_statement exprs with
+      | Some e -> always_returns e
+      | None -> false)
   | TEif (cond, then_e, else_e) -> always_returns then_e && always_returns else_e
+  | TEfor ({ expr_desc = TEconstant (Cbool true) }, _, body) ->
+      (* for { ... } only ends with a break *)
+      not (breaks body || breaks_label body)
+  | TEswitch clauses ->
+      List.exists (function None, _, _ -> true | _ -> false) clauses
+      && List.for_all
+           (fun (_, body, fallthrough) ->
+             (fallthrough || always_returns body)
+             && not (breaks body || breaks_label body))
+           clauses
   | _ -> false
+
+let unreachable_after (e : expr) : bool =
+  match e.expr_desc with
+  | TEbreak | TEcontinue -> true
+  | _ -> always_returns e
@@ -1,3 +1,11 @@
 open Tast
 
 val always_returns : expr -> bool
+(** whether [e] is a terminating statement: a return, a panic or a goto,
+    a block that ends with one, an if whose branches both terminate, a for
+    without a condition nor a break to it, or a switch with a default clause
+    whose clauses all terminate or fall through *)
+
+val unreachable_after : expr -> bool
+(** whether the statements that follow [e] in its block can never be
+    executed: [e] terminates, or is a break or a continue *)
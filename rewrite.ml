@@ -43,8 +43,30 @@ open Tast
        func f(x ty) {                         ...  x  ... &x ... }
     => func f(x ty) { x' := new(ty); *x' = x; ... *x' ... x' ... }
 
-  Note: We assume that structures are never passed by value, returned,
-  or assigned.
+  5. two-value map lookups
+
+       lv1, lv2 = m[k]
+    => vm := m; vk := k; lv1 = vm[vk]; lv2 = (vk is a key of vm)
+
+  6. no unreachable code
+
+       s1; return e; s2; ...; sn
+    => s1; return e
+
+     also after a break, a continue, a goto, or any terminating statement,
+     up to the next label, which a goto may reach
+
+  7. deferred calls, before the other transformations
+
+       func f(...) { ... defer g(e1,...,en) ... }
+    => func f(...) { ... defer f.deferwrap1(e1,...,en) ... }
+       func f.deferwrap1(x1,...,xn) { g(x1,...,xn) }
+
+     so that the code generator only keeps the values of the arguments of
+     a function and its address; fmt.Print, panic, ... are wrapped the same
+
+  Note: a structure is compiled as the address of its fields, so that passing
+  it, returning it, or assigning it copies the fields at that address.
 *)
 
 let debug = ref false
@@ -92,10 +114,13 @@ let rec expr rw e =
   let _ty = e.expr_typ in
   let mk d = { e with expr_desc = d } in
   match e.expr_desc with
-  | TEskip | TEnil | TEconstant _ -> e
+  | TEskip | TEnil | TEconstant _ | TEtyped _ | TEexact _ | TEbreak | TEcontinue
+  | TEline _ | TElabel _ | TEgoto _ ->
+      e
   | TEbinop (op, e1, e2) -> mk (TEbinop (op, expr rw e1, expr rw e2))
   | TEunop (op, e1) -> mk (TEunop (op, expr rw e1))
   | TEnew typ -> e
+  | TEargs -> e
   | TEcall (g, [ { expr_desc = TEcall (f, el) } ]) when many_results f ->
       (* g(f(...)) => var v1,...,vn; f(..., &v1,...,&vn); g(v1,...,vn) *)
       let vl, e = many rw f el in
@@ -108,9 +133,20 @@ let rec expr rw e =
   | TEident v when Vmap.mem v rw.subst -> Vmap.find v rw.subst
   | TEident v -> mk (TEident v)
   | TEdot (e1, f) -> mk (TEdot (expr rw e1, f))
+  | TEindex (e1, e2) -> mk (TEindex (expr rw e1, expr rw e2))
+  | TEarray el -> mk (TEarray (exprs rw el))
+  | TEstruct fl -> mk (TEstruct (List.map (fun (f, e) -> (f, expr rw e)) fl))
+  | TEmap kvl -> mk (TEmap (List.map (fun (k, v) -> (expr rw k, expr rw v)) kvl))
+  | TEcontains (e1, e2) -> mk (TEcontains (expr rw e1, expr rw e2))
+  | TEdelete (e1, e2) -> mk (TEdelete (expr rw e1, expr rw e2))
+  | TElen e1 -> mk (TElen (expr rw e1))
+  | TEconvert e1 -> mk (TEconvert (expr rw e1))
+  | TEappend (e1, el) -> mk (TEappend (expr rw e1, exprs rw el))
+  | TEpanic e1 -> mk (TEpanic (expr rw e1))
+  | TEexit e1 -> mk (TEexit (expr rw e1))
+  | TEdefer e1 -> mk (TEdefer (expr rw e1))
   | TEassign ([], _) | TEassign (_, []) -> assert false
   | TEassign ([ lv ], [ e ]) ->
-      assert (not (is_struct e.expr_typ));
       mk (TEassign ([ expr rw lv ], [ expr rw e ]))
   | TEassign
       (lvl, [ { expr_desc = TEcall (g, [ { expr_desc = TEcall (f, el) } ]) } ])
@@ -119,12 +155,34 @@ let rec expr rw e =
          var v1,...,vk; f(...,&v1,...,&vk); g(v1,...,vk, &lv1,...&lvn) *)
       assert (many_results g);
       let vl, e = many rw f el in
-      let gargs = List.map ident vl @ List.map addr lvl in
-      stmt (TEblock [ stmt (TEvars vl); e; stmt (TEcall (g, gargs)) ])
-  | TEassign (lvl, [ { expr_desc = TEcall (f, el) } ]) ->
+      let bl, results = results lvl in
+      let gargs = List.map ident vl @ results in
+      stmt (TEblock [ stmt (TEvars (vl @ bl)); e; stmt (TEcall (g, gargs)) ])
+  | TEassign (lvl, [ { expr_desc = TEcall (f, el) } ]) -> (
       (* RW2 lv1,...lvn = f(...) => f(..., &lv1,...,&lvn) *)
       assert (many_results f);
-      mk (TEcall (f, exprs rw el @ List.map addr lvl))
+      let bl, results = results lvl in
+      let call = mk (TEcall (f, exprs rw el @ results)) in
+      match bl with [] -> call | _ -> stmt (TEblock [ stmt (TEvars bl); call ]))
+  | TEassign
+      ([ lv1; lv2 ], [ { expr_desc = TEindex (m, k); expr_typ = Tmany [ ty; _ ] } ])
+    ->
+      (* RW5 *)
+      let vm = mkvar m.expr_typ and vk = mkvar k.expr_typ in
+      stmt
+        (TEblock
+           [
+             stmt (TEvars [ vm; vk ]);
+             stmt (TEassign ([ ident vm ], [ expr rw m ]));
+             stmt (TEassign ([ ident vk ], [ expr rw k ]));
+             stmt
+               (TEassign
+                  ([ expr rw lv1 ], [ make (TEindex (ident vm, ident vk)) ty ]));
+             stmt
+               (TEassign
+                  ( [ expr rw lv2 ],
+                    [ make (TEcontains (ident vm, ident vk)) Tbool ] ));
+           ])
   | TEassign (lvl, [ _ ]) -> assert false
   | TEassign (lvl, el) ->
       assert (List.length lvl = List.length el);
@@ -151,9 +209,7 @@ let rec expr rw e =
              stmt (TEreturn []);
            ])
   | TEreturn [] -> mk (TEreturn [])
-  | TEreturn [ e ] ->
-      assert (not (is_struct e.expr_typ));
-      mk (TEreturn [ expr rw e ])
+  | TEreturn [ e ] -> mk (TEreturn [ expr rw e ])
   | TEreturn el ->
       (* RW2 return e1,...,en => *r1 = e1, ..., *rn =en; return *)
       let vl = rw.retvl in
@@ -164,9 +220,17 @@ let rec expr rw e =
       let bl = List.fold_left2 assign [ stmt (TEreturn []) ] vl el in
       stmt (TEblock bl)
   | TEblock bl -> mk (TEblock (block rw bl))
-  | TEfor (e1, e2) -> mk (TEfor (expr rw e1, expr rw e2))
+  | TEfor (e1, e2, e3) -> mk (TEfor (expr rw e1, expr rw e2, expr rw e3))
+  | TEswitch clauses ->
+      let clause (conds, body, fallthrough) =
+        (option_map (exprs rw) conds, expr rw body, fallthrough)
+      in
+      mk (TEswitch (List.map clause clauses))
   | TEprint el -> mk (TEprint (exprs rw el))
+  | TEprintf pl -> mk (TEprintf (pieces rw pl))
+  | TEsprintf pl -> mk (TEsprintf (pieces rw pl))
   | TEincdec (e1, op) -> mk (TEincdec (expr rw e1, op))
+  | TEopassign (op, e1, e2) -> mk (TEopassign (op, expr rw e1, expr rw e2))
   | TEvars _ -> assert false
 
 and many rw f el =
@@ -191,24 +255,57 @@ and many rw f el =
       let fargs = exprs rw el @ fargs in
       (vl, stmt (TEcall (f, fargs)))
 
+(* _ has no address, a temporary receives the result it discards *)
+and results lvl =
+  let result bl lv =
+    match lv.expr_desc with
+    | TEident v when Typing_types.Constants.is_blank v.v_name ->
+        let v = mkvar lv.expr_typ in
+        (v :: bl, addr (ident v))
+    | _ -> (bl, addr lv)
+  in
+  let bl, results = map_fold_left result [] lvl in
+  (List.rev bl, results)
+
 and block rw = function
   | [] -> []
-  | { expr_desc = TEvars (v :: _ as vl) } :: bl
-    when is_struct v.v_typ || v.v_addr ->
-      (* RW3 and RW4 *)
+  | { expr_desc = TEvars vl } :: bl
+    when List.exists (fun v -> is_struct v.v_typ || v.v_addr) vl ->
+      (* RW3 and RW4, only for the variables that need it *)
       let change rw ({ v_typ = ty } as v) =
-        assert (is_struct ty || v.v_addr);
-        let v' = mkvar (Tptr ty) in
-        let e = stmt (TEassign ([ ident v' ], [ make (TEnew ty) (Tptr ty) ])) in
-        (rw_add v (make (TEunop (Ustar, ident v')) ty) rw, (v', e))
+        if is_struct ty || v.v_addr then
+          let v' = mkvar (Tptr ty) in
+          let e =
+            stmt (TEassign ([ ident v' ], [ make (TEnew ty) (Tptr ty) ]))
+          in
+          (rw_add v (make (TEunop (Ustar, ident v')) ty) rw, (v', [ e ]))
+        else (rw, (v, []))
       in
       let rw, l = map_fold_left change rw vl in
-      (stmt (TEvars (List.map fst l)) :: List.map snd l) @ block rw bl
+      (stmt (TEvars (List.map fst l)) :: List.concat_map snd l) @ block rw bl
   | ({ expr_desc = TEvars _ } as e) :: bl -> e :: block rw bl
+  | e :: bl when Return_check.unreachable_after e ->
+      (* RW6 *)
+      let rec reachable = function
+        | ({ expr_desc = TElabel _ } :: _) as bl -> block rw bl
+        | _ :: bl -> reachable bl
+        | [] -> []
+      in
+      expr rw e :: reachable bl
   | e :: bl -> expr rw e :: block rw bl
 
 and exprs rw el = List.map (expr rw) el
 
+and pieces rw pl =
+  let rec piece = function
+    | Fverb (spec, e) -> Fverb (spec, expr rw e)
+    | Fdigits (digits, e) -> Fdigits (digits, expr rw e)
+    | Ffloat e -> Ffloat (expr rw e)
+    | Fpad (width, padding, p) -> Fpad (width, padding, piece p)
+    | Fstring _ as p -> p
+  in
+  List.map piece pl
+
 let function_ f e =
   let param ((rw, init) as acc) ({ v_typ = ty } as v) =
     if is_struct ty then (* RW3 *)
@@ -232,7 +329,7 @@ let function_ f e =
   let rw, pl, tyl =
     match f.fn_typ with
     | [] -> (rw, pl, [])
-    | [ ty ] as tyl when not (is_struct ty) -> (rw, pl, tyl)
+    | [ _ ] as tyl -> (rw, pl, tyl)
     | tyl ->
         let result ty = mkvar (Tptr ty) in
         let vl = List.map result tyl in
@@ -241,8 +338,86 @@ let function_ f e =
   let f = { f with fn_params = pl } in
   TDfunction (f, stmt (TEblock (init @ [ expr rw e ])))
 
+(* the arguments of a deferred call, and the same call with others *)
+let arguments call =
+  let mk d = { call with expr_desc = d } in
+  let rec verb p e =
+    match p with
+    | Fverb (spec, _) -> Fverb (spec, e)
+    | Fdigits (digits, _) -> Fdigits (digits, e)
+    | Ffloat _ -> Ffloat e
+    | Fpad (width, padding, p) -> Fpad (width, padding, verb p e)
+    | Fstring _ -> assert false
+  in
+  let rec replace pl el =
+    match (pl, el) with
+    | (Fstring _ as p) :: pl, el -> p :: replace pl el
+    | p :: pl, e :: el -> verb p e :: replace pl el
+    | [], [] -> []
+    | _ -> assert false
+  in
+  let rec argument = function
+    | Fverb (_, e) | Fdigits (_, e) | Ffloat e -> Some e
+    | Fpad (_, _, p) -> argument p
+    | Fstring _ -> None
+  in
+  let verbs pl = List.filter_map argument pl in
+  match call.expr_desc with
+  | TEcall (f, el) -> (el, fun el -> mk (TEcall (f, el)))
+  | TEprint el -> (el, fun el -> mk (TEprint el))
+  | TEprintf pl -> (verbs pl, fun el -> mk (TEprintf (replace pl el)))
+  | TEsprintf pl -> (verbs pl, fun el -> mk (TEsprintf (replace pl el)))
+  | TEpanic e -> ([ e ], function [ e ] -> mk (TEpanic e) | _ -> assert false)
+  | TEexit e -> ([ e ], function [ e ] -> mk (TEexit e) | _ -> assert false)
+  | TEdelete (m, k) ->
+      ([ m; k ], function [ m; k ] -> mk (TEdelete (m, k)) | _ -> assert false)
+  | _ -> assert false
+
+(* RW7, the wrappers following the function that defers their calls *)
+let deferred_calls = function
+  | TDfunction (f, e) ->
+      let wrappers = ref [] in
+      let line = ref f.fn_loc in
+      let rec lift e =
+        let mk d = { e with expr_desc = d } in
+        match e.expr_desc with
+        | TEline loc ->
+            line := loc;
+            e
+        | TEdefer call ->
+            let el, rebuild = arguments call in
+            let xl = List.map (fun e -> mkvar e.expr_typ) el in
+            let n = List.length !wrappers + 1 in
+            let w =
+              {
+                fn_name = f.fn_name ^ ".deferwrap" ^ string_of_int n;
+                fn_params = xl;
+                fn_typ = [];
+                fn_loc = !line;
+                fn_variadic = false;
+              }
+            in
+            let body =
+              stmt (TEblock [ stmt (TEline !line); rebuild (List.map ident xl) ])
+            in
+            wrappers := TDfunction (w, body) :: !wrappers;
+            mk (TEdefer (stmt (TEcall (w, el))))
+        | TEblock bl -> mk (TEblock (List.map lift bl))
+        | TEif (e1, e2, e3) -> mk (TEif (e1, lift e2, lift e3))
+        | TEfor (e1, e2, e3) -> mk (TEfor (e1, e2, lift e3))
+        | TEswitch clauses ->
+            let clause (conds, body, fallthrough) =
+              (conds, lift body, fallthrough)
+            in
+            mk (TEswitch (List.map clause clauses))
+        | _ -> e
+      in
+      let e = lift e in
+      TDfunction (f, e) :: List.rev !wrappers
+  | TDstruct _ as d -> [ d ]
+
 let decl = function TDfunction (f, e) -> function_ f e | TDstruct _ as d -> d
 
 let file ?debug:(b = false) dl =
   debug := b;
-  List.map decl dl
+  List.map decl (List.concat_map deferred_calls dl)
@@ -0,0 +1,954 @@
+(** Runtime support written directly in assembly.
+
+    These routines are appended to every program. Each of them aligns the
+    stack itself before calling into libc, so they can be called from
+    anywhere in the generated code. *)
+
+open X86_64
+
+(* format_float_ returns in rax a string of the float64 whose bits are in
+   rdi, written the way Go's fmt.Print does: with the shortest decimal
+   representation that reads back as the same float64, in exponent form
+   when the decimal exponent is < -4 or >= 6 ("1e+06", "1.234567e+06",
+   "1e-05") and in fixed form otherwise ("100", "0.0001", "3.75").
+   Infinities and NaN are written "+Inf", "-Inf" and "NaN". The string is
+   freshly allocated, but for those three. *)
+let format_float : text =
+  inline
+    {|
+format_float_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	subq $40, %rsp
+	andq $-16, %rsp
+	movq %rdi, %r12
+	movq %r12, %xmm0
+	ucomisd %xmm0, %xmm0
+	jp .Lff_nan
+	xorq %rbx, %rbx
+.Lff_digits:
+	movq %rsp, %rdi
+	movq $32, %rsi
+	leaq .Lff_sci, %rdx
+	movl %ebx, %ecx
+	movq %r12, %xmm0
+	movl $1, %eax
+	call snprintf
+	movq %rsp, %rdi
+	xorq %rsi, %rsi
+	call strtod
+	movq %r12, %xmm1
+	ucomisd %xmm1, %xmm0
+	je .Lff_found
+	incq %rbx
+	cmpq $17, %rbx
+	jl .Lff_digits
+.Lff_found:
+	movq %rsp, %rdi
+	movl $101, %esi
+	call strchr
+	testq %rax, %rax
+	je .Lff_inf
+	leaq 1(%rax), %rdi
+	call atoi
+	movslq %eax, %r13
+	cmpq $-4, %r13
+	jl .Lff_buffer
+	cmpq $6, %r13
+	jge .Lff_buffer
+	movq %rbx, %rdx
+	subq %r13, %rdx
+	jns .Lff_fixed
+	xorq %rdx, %rdx
+.Lff_fixed:
+	leaq 32(%rsp), %rdi
+	leaq .Lff_fix, %rsi
+	movq %r12, %xmm0
+	movl $1, %eax
+	call asprintf
+	movq 32(%rsp), %rax
+	jmp .Lff_end
+.Lff_buffer:
+	movq %rsp, %rdi
+	call strdup
+	jmp .Lff_end
+.Lff_nan:
+	leaq .Lff_nan_str, %rax
+	jmp .Lff_end
+.Lff_inf:
+	leaq .Lff_pinf_str, %rax
+	testq %r12, %r12
+	jns .Lff_end
+	leaq .Lff_ninf_str, %rax
+.Lff_end:
+	leaq -24(%rbp), %rsp
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+	.section .rodata
+.Lff_sci:
+	.string "%.*e"
+.Lff_fix:
+	.string "%.*f"
+.Lff_nan_str:
+	.string "NaN"
+.Lff_pinf_str:
+	.string "+Inf"
+.Lff_ninf_str:
+	.string "-Inf"
+	.text
+|}
+
+(* print_float_ prints the float64 whose bits are in rdi, as format_float_
+   writes it *)
+let print_float : text =
+  inline
+    {|
+print_float_:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	call format_float_
+	movq %rax, %rsi
+	leaq .Lpf_str, %rdi
+	xorq %rax, %rax
+	call printf
+	leave
+	ret
+	.section .rodata
+.Lpf_str:
+	.string "%s"
+	.text
+|}
+
+(* format_ formats the value in rsi with the printf conversion in rdi into
+   a freshly allocated string, returned in rax *)
+let format : text =
+  inline
+    {|
+format_:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $16, %rsp
+	andq $-16, %rsp
+	movq %rsi, %rdx
+	movq %rdi, %rsi
+	leaq -8(%rbp), %rdi
+	xorq %rax, %rax
+	call asprintf
+	movq -8(%rbp), %rax
+	leave
+	ret
+|}
+
+(* concat_ returns a freshly allocated string holding the string in rdi
+   followed by the string in rsi *)
+let concat : text =
+  inline
+    {|
+concat_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	pushq %r15
+	andq $-16, %rsp
+	movq %rdi, %r12
+	movq %rsi, %r13
+	call strlen
+	movq %rax, %rbx
+	movq %r13, %rdi
+	call strlen
+	movq %rax, %r14
+	leaq 1(%rbx,%r14), %rdi
+	call malloc
+	movq %rax, %r15
+	movq %r15, %rdi
+	movq %r12, %rsi
+	movq %rbx, %rdx
+	call memcpy
+	leaq (%r15,%rbx), %rdi
+	movq %r13, %rsi
+	leaq 1(%r14), %rdx
+	call memcpy
+	movq %r15, %rax
+	leaq -40(%rbp), %rsp
+	popq %r15
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+|}
+
+(* rune_string_ returns a freshly allocated string holding the UTF-8
+   encoding of the code point in rdi, or the one of U+FFFD when it is not
+   a valid code point (negative, a surrogate half or above U+10FFFF) *)
+let rune_string : text =
+  inline
+    {|
+rune_string_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	andq $-16, %rsp
+	movq %rdi, %rbx
+	cmpq $0x10FFFF, %rbx
+	ja .Lrs_invalid
+	movq %rbx, %rax
+	andq $-2048, %rax
+	cmpq $0xD800, %rax
+	jne .Lrs_valid
+.Lrs_invalid:
+	movq $0xFFFD, %rbx
+.Lrs_valid:
+	movq $5, %rdi
+	call malloc
+	movq %rax, %r12
+	movq %rax, %rdi
+	cmpq $0x80, %rbx
+	jae .Lrs_two
+	movb %bl, (%rdi)
+	incq %rdi
+	jmp .Lrs_end
+.Lrs_two:
+	cmpq $0x800, %rbx
+	jae .Lrs_three
+	movq %rbx, %rax
+	shrq $6, %rax
+	orb $0xC0, %al
+	movb %al, (%rdi)
+	incq %rdi
+	jmp .Lrs_last
+.Lrs_three:
+	cmpq $0x10000, %rbx
+	jae .Lrs_four
+	movq %rbx, %rax
+	shrq $12, %rax
+	orb $0xE0, %al
+	movb %al, (%rdi)
+	incq %rdi
+	jmp .Lrs_second_last
+.Lrs_four:
+	movq %rbx, %rax
+	shrq $18, %rax
+	orb $0xF0, %al
+	movb %al, (%rdi)
+	movq %rbx, %rax
+	shrq $12, %rax
+	andb $0x3F, %al
+	orb $0x80, %al
+	movb %al, 1(%rdi)
+	addq $2, %rdi
+.Lrs_second_last:
+	movq %rbx, %rax
+	shrq $6, %rax
+	andb $0x3F, %al
+	orb $0x80, %al
+	movb %al, (%rdi)
+	incq %rdi
+.Lrs_last:
+	movq %rbx, %rax
+	andb $0x3F, %al
+	orb $0x80, %al
+	movb %al, (%rdi)
+	incq %rdi
+.Lrs_end:
+	movb $0, (%rdi)
+	movq %r12, %rax
+	leaq -16(%rbp), %rsp
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+|}
+
+(* digits_ returns a freshly allocated string holding the integer in rdi
+   written with the digits in rdx, of which there are 2^rsi; the integer is
+   signed when rcx is not zero, and is then preceded by - when negative, as
+   Go's %x does; the digits are written from the last one in a buffer of
+   the frame, large enough for the 64 of binary and a sign *)
+let digits : text =
+  inline
+    {|
+digits_:
+	pushq %rbp
+	movq %rsp, %rbp
+	subq $80, %rsp
+	andq $-16, %rsp
+	xorq %r10, %r10
+	testq %rcx, %rcx
+	jz .Ldg_unsigned
+	testq %rdi, %rdi
+	jns .Ldg_unsigned
+	negq %rdi
+	movq $1, %r10
+.Ldg_unsigned:
+	movq %rsi, %rcx
+	movq $1, %r11
+	shlq %cl, %r11
+	decq %r11
+	leaq -8(%rbp), %r8
+	movb $0, (%r8)
+.Ldg_loop:
+	decq %r8
+	movq %rdi, %rax
+	andq %r11, %rax
+	movb (%rdx,%rax), %al
+	movb %al, (%r8)
+	shrq %cl, %rdi
+	jnz .Ldg_loop
+	testq %r10, %r10
+	jz .Ldg_end
+	decq %r8
+	movb $45, (%r8)
+.Ldg_end:
+	movq %r8, %rdi
+	call strdup
+	leave
+	ret
+|}
+
+(* pad_ returns the string in rdi padded to the width in rsi, counted in
+   runes (the bytes that do not continue a UTF-8 sequence), or the string
+   itself when it is not narrower; the padding depends on rdx: 0 for spaces
+   on the left, 1 for spaces on the right, 2 for zeros on the left and 3
+   for zeros after the - of a negative number *)
+let pad : text =
+  inline
+    {|
+pad_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	pushq %r15
+	andq $-16, %rsp
+	movq %rdi, %r12
+	movq %rsi, %r14
+	movq %rdx, %r13
+	xorq %rbx, %rbx
+	xorq %rcx, %rcx
+.Lpad_count:
+	movzbq (%r12,%rbx), %rax
+	testq %rax, %rax
+	jz .Lpad_counted
+	incq %rbx
+	andq $0xC0, %rax
+	cmpq $0x80, %rax
+	je .Lpad_count
+	incq %rcx
+	jmp .Lpad_count
+.Lpad_counted:
+	movq %r12, %rax
+	subq %rcx, %r14
+	jle .Lpad_end
+	leaq 1(%rbx,%r14), %rdi
+	call malloc
+	movq %rax, %r15
+	movq %rax, %rdi
+	cmpq $1, %r13
+	je .Lpad_right
+	movq $32, %rsi
+	testq %r13, %r13
+	jz .Lpad_fill
+	movq $48, %rsi
+	cmpq $3, %r13
+	jne .Lpad_fill
+	cmpb $45, (%r12)
+	jne .Lpad_fill
+	movb $45, (%rdi)
+	incq %rdi
+	incq %r12
+	decq %rbx
+.Lpad_fill:
+	movq %rdi, %r13
+	movq %r14, %rdx
+	call memset
+	leaq (%r13,%r14), %rdi
+	movq %r12, %rsi
+	leaq 1(%rbx), %rdx
+	call memcpy
+	movq %r15, %rax
+	jmp .Lpad_end
+.Lpad_right:
+	movq %r12, %rsi
+	movq %rbx, %rdx
+	call memcpy
+	leaq (%r15,%rbx), %rdi
+	movq $32, %rsi
+	movq %r14, %rdx
+	call memset
+	leaq (%r15,%rbx), %rax
+	movb $0, (%rax,%r14)
+	movq %r15, %rax
+.Lpad_end:
+	leaq -40(%rbp), %rsp
+	popq %r15
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+|}
+
+(* panic_ stops the program, like Go does, with exit status 2, after
+   printing the message in rdi and the position in rsi on the standard
+   error; the position may be null *)
+let panic : text =
+  inline
+    {|
+panic_:
+	pushq %rbp
+	movq %rsp, %rbp
+	andq $-16, %rsp
+	movq %rsi, %rcx
+	movq %rdi, %rdx
+	movq stderr, %rdi
+	leaq .Lpa_msg, %rsi
+	testq %rcx, %rcx
+	jne .Lpa_print
+	leaq .Lpa_short, %rsi
+.Lpa_print:
+	xorq %rax, %rax
+	call fprintf
+	movq $2, %rdi
+	call exit
+	.section .rodata
+.Lpa_msg:
+	.string "panic: %s\n\ngoroutine 1 [running]:\n%s\n"
+.Lpa_short:
+	.string "panic: %s\n"
+	.text
+|}
+
+(* run_defers_ makes the deferred calls recorded from rdi: a record is the
+   address of the next one, that of a function, the number n of its
+   arguments and their n values, which are passed on the stack, the first
+   one on top *)
+let run_defers : text =
+  inline
+    {|
+run_defers_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rdi
+.Lrd_next:
+	movq -8(%rbp), %rcx
+	testq %rcx, %rcx
+	je .Lrd_end
+	movq (%rcx), %rax
+	movq %rax, -8(%rbp)
+	leaq -8(%rbp), %rsp
+	movq 16(%rcx), %rdx
+	leaq (,%rdx,8), %rax
+	subq %rax, %rsp
+.Lrd_copy:
+	testq %rdx, %rdx
+	je .Lrd_call
+	decq %rdx
+	movq 24(%rcx,%rdx,8), %rax
+	movq %rax, (%rsp,%rdx,8)
+	jmp .Lrd_copy
+.Lrd_call:
+	call *8(%rcx)
+	jmp .Lrd_next
+.Lrd_end:
+	leave
+	ret
+|}
+
+(* index_error_ panics, at the position in rdx, when the index in rdi is
+   out of the range of an array whose length is in rsi *)
+let index_error : text =
+  inline
+    {|
+index_error_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	andq $-16, %rsp
+	subq $128, %rsp
+	movq %rdx, %rbx
+	movq %rsi, %rcx
+	movq %rdi, %rdx
+	movq %rsp, %rdi
+	leaq .Lie_msg, %rsi
+	xorq %rax, %rax
+	call sprintf
+	movq %rsp, %rdi
+	movq %rbx, %rsi
+	call panic_
+	.section .rodata
+.Lie_msg:
+	.string "runtime error: index out of range [%ld] with length %ld"
+	.text
+|}
+
+(* append_ returns a new header for the slice in rdi (null for nil) followed
+   by rsi more elements of rdx bytes each, which the caller then stores at
+   its end. They are added in place when the capacity is large enough, so
+   that the new slice shares its elements with the old one. Otherwise the
+   capacity is doubled, or set to the new length if that is still too small,
+   and the elements are copied into a new zeroed array: appending n elements
+   one at a time costs O(n) copies in total. *)
+let append : text =
+  inline
+    {|
+append_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	pushq %r15
+	andq $-16, %rsp
+	xorq %rbx, %rbx
+	xorq %r14, %r14
+	xorq %r15, %r15
+	testq %rdi, %rdi
+	je .Lap_nil
+	movq (%rdi), %r15
+	movq 8(%rdi), %rbx
+	movq 16(%rdi), %r14
+.Lap_nil:
+	leaq (%rbx,%rsi), %r12
+	movq %rdx, %r13
+	cmpq %r14, %r12
+	jle .Lap_header
+	addq %r14, %r14
+	cmpq %r12, %r14
+	jge .Lap_grow
+	movq %r12, %r14
+.Lap_grow:
+	movq %r14, %rdi
+	movq %r13, %rsi
+	call calloc
+	movq %r15, %rsi
+	movq %rax, %r15
+	movq %rax, %rdi
+	movq %rbx, %rdx
+	imulq %r13, %rdx
+	call memcpy
+.Lap_header:
+	movq $24, %rdi
+	call malloc
+	movq %r15, (%rax)
+	movq %r12, 8(%rax)
+	movq %r14, 16(%rax)
+	leaq -40(%rbp), %rsp
+	popq %r15
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+|}
+
+(* a map is the address of a header: the number of keys, the number of
+   slots (a power of 2), the addresses of the keys, of the values and of the
+   state of each slot (0 empty, 1 used, 2 deleted), the size of a value, the
+   kind of keys (0 compared as 64-bit integers, 1 as strings, 2 as floats,
+   which are hashed by their bits), and the number of deleted slots; nil is
+   a null address. Keys are found by linear probing from their hash, and
+   the slots are reallocated when more than 3/4 of them are not empty.
+
+   map_make_ returns an empty map whose values have rdi bytes, and keys the
+   kind in rsi. map_lookup_ returns the address of the value of the key rsi
+   in the map rdi, null when it is not there. map_assign_ returns the address
+   of the value of the key rsi, inserted with a zeroed value when it was not
+   there, in which case rdx is 1; assigning to a nil map panics, at the
+   position in rdx. map_delete_ removes the key rsi, if it is there.
+   map_sorted_ returns a fresh array of the used slots of the map rdi, in the
+   order of their keys, for printing. *)
+let map : text =
+  inline
+    {|
+map_make_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	andq $-16, %rsp
+	movq %rdi, %rbx
+	movq %rsi, %r12
+	movq $1, %rdi
+	movq $64, %rsi
+	call calloc
+	movq %rbx, 40(%rax)
+	movq %r12, 48(%rax)
+	movq %rax, %rbx
+	movq %rax, %rdi
+	movq $8, %rsi
+	call .Lmap_alloc
+	movq %rbx, %rax
+	leaq -16(%rbp), %rsp
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+.Lmap_alloc:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	andq $-16, %rsp
+	movq %rdi, %rbx
+	movq %rsi, %r12
+	movq %r12, 8(%rbx)
+	movq $0, 56(%rbx)
+	movq %r12, %rdi
+	movq $8, %rsi
+	call calloc
+	movq %rax, 16(%rbx)
+	movq %r12, %rdi
+	movq 40(%rbx), %rsi
+	call calloc
+	movq %rax, 24(%rbx)
+	movq %r12, %rdi
+	movq $1, %rsi
+	call calloc
+	movq %rax, 32(%rbx)
+	leaq -16(%rbp), %rsp
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+.Lmap_hash:
+	cmpq $1, 48(%rdi)
+	je .Lmh_string
+	movq %rsi, %rax
+	movabsq $0x9e3779b97f4a7c15, %rcx
+	imulq %rcx, %rax
+	movq %rax, %rcx
+	shrq $32, %rcx
+	xorq %rcx, %rax
+	ret
+.Lmh_string:
+	movabsq $0xcbf29ce484222325, %rax
+	movabsq $0x100000001b3, %rcx
+.Lmh_loop:
+	movzbq (%rsi), %rdx
+	testq %rdx, %rdx
+	je .Lmh_end
+	xorq %rdx, %rax
+	imulq %rcx, %rax
+	incq %rsi
+	jmp .Lmh_loop
+.Lmh_end:
+	ret
+.Lmap_probe:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	pushq %r15
+	andq $-16, %rsp
+	movq %rdi, %rbx
+	movq %rsi, %r12
+	call .Lmap_hash
+	movq 8(%rbx), %r15
+	decq %r15
+	andq %r15, %rax
+	movq %rax, %r13
+	movq $-1, %r14
+.Lmp_loop:
+	movq 32(%rbx), %rax
+	movzbq (%rax,%r13), %rax
+	testq %rax, %rax
+	je .Lmp_empty
+	cmpq $2, %rax
+	je .Lmp_deleted
+	movq 16(%rbx), %rax
+	movq (%rax,%r13,8), %rdi
+	cmpq $1, 48(%rbx)
+	je .Lmp_string
+	cmpq %rdi, %r12
+	je .Lmp_found
+	jmp .Lmp_next
+.Lmp_string:
+	movq %r12, %rsi
+	call strcmp
+	testl %eax, %eax
+	je .Lmp_found
+	jmp .Lmp_next
+.Lmp_deleted:
+	cmpq $-1, %r14
+	jne .Lmp_next
+	movq %r13, %r14
+.Lmp_next:
+	incq %r13
+	andq %r15, %r13
+	jmp .Lmp_loop
+.Lmp_empty:
+	xorq %rdx, %rdx
+	movq %r13, %rax
+	cmpq $-1, %r14
+	je .Lmp_end
+	movq %r14, %rax
+	jmp .Lmp_end
+.Lmp_found:
+	movq $1, %rdx
+	movq %r13, %rax
+.Lmp_end:
+	leaq -40(%rbp), %rsp
+	popq %r15
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+.Lmap_grow:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	pushq %r15
+	subq $8, %rsp
+	andq $-16, %rsp
+	movq %rdi, %rbx
+	movq 16(%rbx), %r12
+	movq 24(%rbx), %r13
+	movq 32(%rbx), %r14
+	movq 8(%rbx), %rsi
+	movq %rsi, -48(%rbp)
+	movq (%rbx), %rcx
+	leaq 1(%rcx,%rcx), %rcx
+	cmpq %rsi, %rcx
+	jl .Lmg_alloc
+	addq %rsi, %rsi
+.Lmg_alloc:
+	call .Lmap_alloc
+	xorq %r15, %r15
+.Lmg_loop:
+	cmpq -48(%rbp), %r15
+	jge .Lmg_end
+	cmpb $1, (%r14,%r15)
+	jne .Lmg_next
+	movq %rbx, %rdi
+	movq (%r12,%r15,8), %rsi
+	call .Lmap_probe
+	movq 32(%rbx), %rcx
+	movb $1, (%rcx,%rax)
+	movq 16(%rbx), %rcx
+	movq (%r12,%r15,8), %rdx
+	movq %rdx, (%rcx,%rax,8)
+	movq 40(%rbx), %rdx
+	imulq %rdx, %rax
+	addq 24(%rbx), %rax
+	movq %rax, %rdi
+	movq %r15, %rsi
+	imulq %rdx, %rsi
+	addq %r13, %rsi
+	call memcpy
+.Lmg_next:
+	incq %r15
+	jmp .Lmg_loop
+.Lmg_end:
+	leaq -40(%rbp), %rsp
+	popq %r15
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+map_lookup_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	andq $-16, %rsp
+	xorq %rax, %rax
+	testq %rdi, %rdi
+	je .Lml_end
+	movq %rdi, %rbx
+	call .Lmap_probe
+	testq %rdx, %rdx
+	je .Lml_missing
+	imulq 40(%rbx), %rax
+	addq 24(%rbx), %rax
+	jmp .Lml_end
+.Lml_missing:
+	xorq %rax, %rax
+.Lml_end:
+	leaq -16(%rbp), %rsp
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+map_assign_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	andq $-16, %rsp
+	testq %rdi, %rdi
+	je .Lma_nil
+	movq %rdi, %rbx
+	movq %rsi, %r12
+	call .Lmap_probe
+	xorq %r14, %r14
+	testq %rdx, %rdx
+	jne .Lma_value
+	movq (%rbx), %rcx
+	addq 56(%rbx), %rcx
+	leaq 4(,%rcx,4), %rcx
+	movq 8(%rbx), %rdx
+	leaq (%rdx,%rdx,2), %rdx
+	cmpq %rdx, %rcx
+	jle .Lma_insert
+	movq %rbx, %rdi
+	call .Lmap_grow
+	movq %rbx, %rdi
+	movq %r12, %rsi
+	call .Lmap_probe
+.Lma_insert:
+	movq 32(%rbx), %rcx
+	cmpb $2, (%rcx,%rax)
+	jne .Lma_empty
+	decq 56(%rbx)
+.Lma_empty:
+	movb $1, (%rcx,%rax)
+	movq 16(%rbx), %rcx
+	movq %r12, (%rcx,%rax,8)
+	incq (%rbx)
+	movq $1, %r14
+.Lma_value:
+	imulq 40(%rbx), %rax
+	addq 24(%rbx), %rax
+	movq %r14, %rdx
+	leaq -32(%rbp), %rsp
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+.Lma_nil:
+	leaq .Lma_msg, %rdi
+	movq %rdx, %rsi
+	call panic_
+	.section .rodata
+.Lma_msg:
+	.string "assignment to entry in nil map"
+	.text
+map_delete_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	andq $-16, %rsp
+	testq %rdi, %rdi
+	je .Lmd_end
+	movq %rdi, %rbx
+	call .Lmap_probe
+	testq %rdx, %rdx
+	je .Lmd_end
+	movq 32(%rbx), %rcx
+	movb $2, (%rcx,%rax)
+	decq (%rbx)
+	incq 56(%rbx)
+	movq 40(%rbx), %rdx
+	imulq %rdx, %rax
+	addq 24(%rbx), %rax
+	movq %rax, %rdi
+	xorq %rsi, %rsi
+	call memset
+.Lmd_end:
+	leaq -16(%rbp), %rsp
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+map_sorted_:
+	pushq %rbp
+	movq %rsp, %rbp
+	pushq %rbx
+	pushq %r12
+	pushq %r13
+	pushq %r14
+	pushq %r15
+	andq $-16, %rsp
+	movq %rdi, %rbx
+	movq (%rbx), %rdi
+	leaq 8(,%rdi,8), %rdi
+	call malloc
+	movq %rax, %r12
+	xorq %r13, %r13
+	xorq %r14, %r14
+.Lms_slot:
+	cmpq 8(%rbx), %r14
+	jge .Lms_end
+	movq 32(%rbx), %rax
+	cmpb $1, (%rax,%r14)
+	jne .Lms_next
+	movq %r13, %r15
+.Lms_shift:
+	testq %r15, %r15
+	je .Lms_insert
+	movq 16(%rbx), %rax
+	movq -8(%r12,%r15,8), %rdi
+	movq (%rax,%rdi,8), %rdi
+	movq (%rax,%r14,8), %rsi
+	movq 48(%rbx), %rdx
+	call .Lmap_greater
+	testl %eax, %eax
+	jle .Lms_insert
+	movq -8(%r12,%r15,8), %rax
+	movq %rax, (%r12,%r15,8)
+	decq %r15
+	jmp .Lms_shift
+.Lms_insert:
+	movq %r14, (%r12,%r15,8)
+	incq %r13
+.Lms_next:
+	incq %r14
+	jmp .Lms_slot
+.Lms_end:
+	movq %r12, %rax
+	leaq -40(%rbp), %rsp
+	popq %r15
+	popq %r14
+	popq %r13
+	popq %r12
+	popq %rbx
+	popq %rbp
+	ret
+.Lmap_greater:
+	cmpq $1, %rdx
+	je strcmp
+	xorl %eax, %eax
+	cmpq $2, %rdx
+	je .Lmgt_float
+	cmpq %rsi, %rdi
+	setg %al
+	ret
+.Lmgt_float:
+	movq %rdi, %xmm0
+	movq %rsi, %xmm1
+	ucomisd %xmm1, %xmm0
+	seta %al
+	ret
+|}
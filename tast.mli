@@ -10,9 +10,11 @@ type constant = Ast.constant
 type incdec = Ast.incdec
 
 type function_ = {
-    fn_name: string;
-  fn_params: var list;
-     fn_typ: typ list;
+        fn_name: string;
+      fn_params: var list;
+ mutable fn_typ: typ list;
+         fn_loc: Ast.location; (** of its name *)
+    fn_variadic: bool; (** the last parameter is ...T, a slice []T *)
 }
 
 and structure = {
@@ -24,8 +26,19 @@ and structure = {
 
 and typ =
   | Tint | Tbool | Tstring
+  | Tfloat (** float64 *)
+  | Tinteger of int * bool
+      (** the other integer types, by number of bits and signedness: rune
+          is int32 and byte is uint8 *)
   | Tstruct of structure
   | Tptr of typ
+  | Tarray of typ * int (** element type and length *)
+  | Tslice of typ
+  | Tmap of typ * typ (** key and value types *)
+  | Tnamed of string * typ Lazy.t
+      (** a type declared by type T U, its name and underlying type, that
+          is never a named type; it is computed when first needed, as T
+          may refer to itself through a pointer, a slice or a map *)
   | Tnil (** to type nil *)
   | Tmany of typ list (** when 0 or >= 2 return types *)
 
@@ -33,15 +46,17 @@ and var = {
           v_name: string;
             v_id: int; (** unique *)
            v_loc: Ast.location;
-           v_typ: typ;
+   mutable v_typ: typ;
   mutable v_used: bool;
   mutable v_addr: bool; (** means &x is used somewhere *)
   mutable  v_ofs: int; (** relative to %rbp *)
+         v_const: expr_desc option;
+          (** value of a constant, TEconstant or TEtyped, never stored *)
 }
 
 and field = {
          f_name: string;
-          f_typ: typ;
+  mutable f_typ: typ;
   mutable f_ofs: int; (** relative to the start of the structure *)
 }
 
@@ -51,7 +66,14 @@ and expr =
 
 and expr_desc =
   | TEskip
-  | TEconstant of constant
+  | TEconstant of constant (** an untyped constant, of its default type *)
+  | TEtyped of constant
+      (** a typed constant, of the type of the expression, that is not
+          converted implicitly; erased into a TEconstant with the named
+          types *)
+  | TEexact of Bigint.t
+      (** an untyped integer constant beyond int64, only an operand of other
+          constants or converted, by the type checker *)
   | TEbinop of binop * expr * expr
   | TEunop of unop * expr
   | TEnil
@@ -59,14 +81,58 @@ and expr_desc =
   | TEcall of function_ * expr list
   | TEident of var
   | TEdot of expr * field
+  | TEindex of expr * expr
+      (** array, slice or map, index or key; v, ok = m[k] has the type
+          (v, bool) *)
+  | TEarray of expr list
+      (** array or slice literal, the missing elements of an array are zero *)
+  | TEstruct of (field * expr) list
+      (** struct literal, the missing fields are zero *)
+  | TEmap of (expr * expr) list (** map literal, keys and values *)
+  | TEcontains of expr * expr (** whether the key is in the map *)
+  | TEdelete of expr * expr (** map, key *)
+  | TElen of expr (** length of a string, an array, a slice or a map *)
+  | TEconvert of expr (** to the type of the conversion, T(e) *)
+  | TEappend of expr * expr list (** slice, elements appended to it *)
+  | TEpanic of expr (** stops the program with the message, a string *)
+  | TEexit of expr (** os.Exit, without running the deferred calls *)
+  | TEargs (** os.Args *)
   | TEassign of expr list * expr list
   | TEvars of var list
   | TEif of expr * expr * expr
   | TEreturn of expr list
   | TEblock of expr list
-  | TEfor of expr * expr
+  | TEfor of expr * expr * expr (** condition, post statement, body *)
   | TEprint of expr list
+  | TEprintf of format_piece list
+  | TEsprintf of format_piece list (** string formatted by fmt.Sprintf *)
   | TEincdec of expr * incdec
+  | TEopassign of binop * expr * expr (** x += e, ... *)
+  | TEbreak
+  | TEcontinue
+  | TEswitch of (expr list option * expr * bool) list
+      (** clauses in source order: conditions (None for default), body, and
+          whether the body ends with fallthrough *)
+  | TEline of Ast.location
+      (** where the next statement of the block starts, for the line table
+          of the debug information *)
+  | TEdefer of expr (** call made when the function returns *)
+  | TElabel of string (** the target of the gotos to it *)
+  | TEgoto of string
+
+and format_piece =
+  | Fstring of string (** literal text between two verbs *)
+  | Fverb of string * expr (** C printf conversion and its argument *)
+  | Fdigits of string * expr
+      (** integer written with these digits, 2, 8 or 16 of them (%b, %o, %x) *)
+  | Ffloat of expr (** float64 written as fmt.Print does (%v) *)
+  | Fpad of int * padding * format_piece
+      (** a verb padded to a width, counted in runes (%5d, %-5s, %05x) *)
+
+and padding =
+  | Pleft (** spaces on the left *)
+  | Pright (** spaces on the right, with the - flag *)
+  | Pzeros (** zeros on the left, after the sign of a number, with 0 *)
 
 type tdecl =
   | TDfunction of function_ * expr
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func square(x int) int {
+	return x * x
+}
+
+func main() {
+	n := 3
+	for i := 0; i < n; i++ {
+		fmt.Println(square(i))
+	}
+	if n > 2 {
+		n--
+	}
+	fmt.Println(n)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := "é" ? 1
+	fmt.Print(x)
+}
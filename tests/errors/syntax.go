@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	s := "日本語" )
+	fmt.Print(s)
+}
@@ -0,0 +1,8 @@
+package main
+
+import "fmt"
+
+func main() {
+	zero := 0
+	fmt.Print((6 * 7) / (zero * 3))
+}
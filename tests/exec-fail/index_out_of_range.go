@@ -0,0 +1,7 @@
+package main
+import "fmt"
+func main() {
+	var a [3]int
+	i := 3
+	fmt.Print(a[i])
+}
@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func main() {
+	n := 3
+	for i := 0; i < 5; i++ {
+		fmt.Print(1<<n, "\n")
+		n--
+	}
+}
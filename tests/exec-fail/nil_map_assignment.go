@@ -0,0 +1,9 @@
+package main
+
+import "fmt"
+
+func main() {
+	var m map[string]int
+	fmt.Print(m["a"], "\n")
+	m["a"] = 1
+}
@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+func check(n int) int {
+	if n < 0 {
+		panic("negative: " + fmt.Sprintf("%d", n))
+	}
+	return n
+}
+
+func main() {
+	fmt.Print(check(1), "\n")
+	fmt.Print(check(-1), "\n")
+	fmt.Print("not reached\n")
+}
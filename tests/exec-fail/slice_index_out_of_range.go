@@ -0,0 +1,7 @@
+package main
+import "fmt"
+func main() {
+	s := []int{1, 2}
+	s = append(s, 3)
+	fmt.Print(s[len(s)])
+}
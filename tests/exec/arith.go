@@ -0,0 +1,13 @@
+package main
+import "fmt"
+func main() {
+	fmt.Print(2 + 3 * 4, "\n")
+	fmt.Print((2 + 3) * 4, "\n")
+	fmt.Print(10 - 4 - 3, "\n")
+	fmt.Print(100 / 10 / 5, "\n")
+	fmt.Print(17 % 5, "\n")
+	fmt.Print(-17 % 5, "\n")
+	fmt.Print(-7 / 2, "\n")
+	fmt.Print(2 * (3 + 4) - 10 / (1 + 1), "\n")
+	fmt.Print(((1 + 2) * (3 + 4)) % 8, "\n")
+}
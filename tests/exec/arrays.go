@@ -0,0 +1,66 @@
+package main
+
+import "fmt"
+
+const N = 3
+
+func sum(a [N]int) int {
+	s := 0
+	for i := 0; i < N; i++ {
+		s += a[i]
+	}
+	return s
+}
+
+// a is a copy: the caller's array is left unchanged
+func clear(a [N]int) [N]int {
+	for i := 0; i < N; i++ {
+		a[i] = 0
+	}
+	return a
+}
+
+func main() {
+	var a [3]int
+	a[0] = 10
+	a[2] = a[0] + 5
+	fmt.Print(a[0], " ", a[1], " ", a[2], "\n")
+	fmt.Print(a, "\n")
+
+	b := [3]int{1, 2, 3}
+	fmt.Print(b, " ", sum(b), "\n")
+	c := b
+	c[0] = 100
+	fmt.Print(b, " ", c, "\n")
+	d := clear(c)
+	fmt.Print(c, " ", d, "\n")
+
+	var s [2]string
+	s[1] = "world"
+	fmt.Print("[", s[0], "] [", s[1], "]\n")
+	fmt.Print([3]string{"a", "b"}, "\n")
+
+	flags := [2]bool{true}
+	flags[1] = !flags[0]
+	fmt.Print(flags, "\n")
+
+	m := [2][3]int{{1, 2, 3}, {4, 5}}
+	m[1][2] = 6
+	fmt.Print(m, " ", m[1], "\n")
+	row := m[0]
+	row[0] = 0
+	fmt.Print(m[0], " ", row, "\n")
+	m[1] = row
+	fmt.Print(m, "\n")
+
+	p := &b
+	p[1] = 20
+	(*p)[2]++
+	fmt.Print(b, "\n")
+	q := &b[0]
+	*q = -1
+	fmt.Print(b, "\n")
+
+	var e [0]int
+	fmt.Print(e, " ", [2]float64{1.5, 2}, "\n")
+}
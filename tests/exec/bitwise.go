@@ -0,0 +1,55 @@
+package main
+
+import "fmt"
+
+// the number of bits set in x
+func popcount(x int) int {
+	n := 0
+	for x != 0 {
+		x &= x - 1
+		n++
+	}
+	return n
+}
+
+func shift(x int, n int) (int, int) {
+	return x << n, x >> n
+}
+
+func main() {
+	fmt.Println(1<<10, 0xFF&0x0F, ^0)
+	fmt.Println(6&3, 6|3, 6^3, 6&^3)
+	fmt.Println(1+2<<3, 1|2^3&4, 7&^2|8, -8>>1, ^5)
+
+	x := 0x5A
+	fmt.Println(x<<4, x>>4, x&0xF0, x|0x0F, x^0xFF, x&^0x0A, ^x)
+	for n := 0; n < 6; n++ {
+		fmt.Print(popcount(n*37), " ")
+	}
+	fmt.Println()
+
+	// counts of 64 or more shift out every bit
+	fmt.Println(shift(1, 63))
+	fmt.Println(shift(1, 64))
+	fmt.Println(shift(-5, 100))
+	fmt.Println(shift(-5, 2))
+
+	var b byte = 0xF0
+	fmt.Println(b<<1, b>>4, ^b, b&^0x30, b|1, b^0xFF)
+	var r rune = 'a'
+	fmt.Println(r&^0x20, r<<24, r<<25)
+	var k byte = 3
+	fmt.Println(x<<k, b<<k)
+
+	y := 1
+	y <<= 5
+	y |= 3
+	y ^= 1
+	y &^= 32
+	y >>= 1
+	y &= 7
+	fmt.Println(y)
+
+	const mask = 1<<8 - 1
+	fmt.Println(mask, mask&^0x0F, 1<<62)
+}
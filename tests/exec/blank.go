@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+func count(s string) int {
+	fmt.Print(s, "\n")
+	return 1
+}
+
+func pair(n int) (int, int) {
+	fmt.Print("pair ", n, "\n")
+	return n, n * n
+}
+
+func main() {
+	_ = count("assigned to _")
+	_ = count("assigned to _ again")
+	x, _ := pair(3)
+	_, y := pair(4)
+	_, _ = pair(5)
+	fmt.Print(x, " ", y, "\n")
+	var _ = count("declared as _")
+	a, _, b := 1, count("in a list"), 2
+	fmt.Print(a+b, "\n")
+	_, x = pair(6)
+	fmt.Print(x, "\n")
+}
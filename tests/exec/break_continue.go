@@ -0,0 +1,40 @@
+package main
+import "fmt"
+func main() {
+	for i := 0; i < 10; i++ {
+		if i == 2 {
+			continue
+		}
+		if i == 5 {
+			break
+		}
+		fmt.Print(i, "\n")
+	}
+	n := 0
+	for {
+		n++
+		if n > 3 {
+			break
+		}
+	}
+	fmt.Print("n=", n, "\n")
+	for i := 0; i < 3; i++ {
+		for j := 0; j < 3; j++ {
+			if j == 1 {
+				continue
+			}
+			if j > i {
+				break
+			}
+			fmt.Print(i, ",", j, "\n")
+		}
+	}
+	k := 0
+	for k < 5 {
+		k++
+		if k % 2 == 0 {
+			continue
+		}
+		fmt.Print("odd ", k, "\n")
+	}
+}
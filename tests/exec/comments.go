@@ -0,0 +1,16 @@
+package main
+
+import "fmt"
+
+// un commentaire en tête de fichier
+
+/* un commentaire
+   sur plusieurs lignes */
+
+func main() {
+	x := 1 // fin de ligne
+	y := 2 /* agit comme
+	un retour à la ligne */ z := 3
+	/* a /* b */ fmt.Println(x, y, z)
+	fmt.Println("// pas un commentaire", "/* non plus */")
+} // sans retour à la ligne final
\ No newline at end of file
@@ -0,0 +1,14 @@
+package main
+import "fmt"
+func main() {
+	a := 3
+	b := 7
+	fmt.Println(a < b, a <= b, a > b, a >= b, a == b, a != b)
+	fmt.Println(a < a, a <= a, b > b, b >= b, a == a, a != a)
+	fmt.Println(-1 < 0, 1 + 2 == 3, 2 * 3 > 5 + 1)
+	s := "apple"
+	t := "banana"
+	fmt.Println(s < t, s > t, s == t, s != t, s == "apple")
+	fmt.Println("abc" < "abd", "ab" < "abc", "" < "a", "b" <= "b")
+	fmt.Println(true == true, true != false)
+}
@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+const greeting = "hello" + ", " + "world"
+
+func repeat(s string, n int) string {
+	r := ""
+	for i := 0; i < n; i++ {
+		r = r + s
+	}
+	return r
+}
+
+func name(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func main() {
+	s := "a"
+	s = s + "b" + "c"
+	fmt.Print(s, "\n")
+	s += "d"
+	fmt.Print(s, "\n")
+	fmt.Print(greeting, "\n")
+	fmt.Print(repeat("ab", 3), "\n")
+	fmt.Print(name(true)+"/"+name(false), "\n")
+	t := s
+	s = s + "e"
+	fmt.Print(t, " ", s, "\n")
+	fmt.Print(len(repeat("xyz", 4)), "\n")
+	fmt.Print(""+""+"", "|\n")
+	fmt.Print(s+s == "abcdeabcde", "\n")
+}
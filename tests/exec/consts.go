@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+const Pi = 3.14
+
+const (
+	A = iota
+	B
+	C
+)
+
+const (
+	KB = 1024 * (iota + 1)
+	MB
+	_
+	TB
+)
+
+const N = 5
+const Greeting, Loud = "hello", true
+const Half float64 = 1
+const Huge = 1 << 100
+
+func square(x int) int {
+	return x * x
+}
+
+func main() {
+	fmt.Println(Pi)
+	fmt.Println(A, B, C)
+	fmt.Println(KB, MB, TB)
+	fmt.Println(square(N), N*2 > 9)
+	fmt.Println(Greeting, Loud, Half)
+	fmt.Println(Huge>>98, Huge/(Huge>>3), -Huge>>99, uint64(1<<64-1))
+	const Local = N - 1
+	for i := 0; i < Local; i++ {
+		fmt.Print(i)
+	}
+	fmt.Println()
+	const (
+		X, Y = iota, -iota
+		Z, W
+	)
+	fmt.Println(X, Y, Z, W)
+	N := "shadowed"
+	fmt.Println(N)
+}
@@ -0,0 +1,27 @@
+package main
+
+import "fmt"
+
+func main() {
+	n := 7
+	f := float64(n) / 2.0
+	fmt.Println(f, float64(5), float64(-3)+0.5)
+	x := 3.9
+	y := -3.9
+	fmt.Println(int(x), int(y), int(f*2.0), int(2.0))
+	var big float64 = 1e18
+	fmt.Println(int(big), int(0.5e1))
+	r := 'é'
+	fmt.Println(string(r), string('世'), string(r+1), string(65))
+	var c rune = 0x1F600
+	fmt.Println(string(c), len(string(c)), string(rune(-1)) == "�")
+	var b byte = 200
+	fmt.Println(int(b)+100, byte(300-n), rune(b)*2, int(r))
+	i := 1000
+	fmt.Println(byte(i), rune(i), byte(-i), float64(byte(i)))
+	var m rune = 2147483647
+	g := 258.7
+	fmt.Println(rune(int(m)+1), int(float64(m)), byte(g))
+	s := "abc"
+	fmt.Println(string(s), int(int(n)), float64(f))
+}
@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+
+func f(x int) int {
+	if x > 0 {
+		return 1
+		fmt.Println("after return")
+	}
+	for {
+		if x < -2 {
+			return x
+		}
+		x--
+	}
+}
+
+func g(n int) int {
+	switch {
+	case n > 10:
+		return 2
+	case n > 5:
+		fallthrough
+	default:
+		return 3
+	}
+}
+
+func h(x int) int {
+	{
+		return x * 2
+	}
+}
+
+func main() {
+	fmt.Println(f(1), f(0), g(11), g(7), g(0), h(4))
+	for i := 0; i < 3; i++ {
+		if i == 1 {
+			continue
+			fmt.Println("after continue", i)
+		}
+		fmt.Println(i)
+	}
+	for i := 0; ; i++ {
+		if i == 2 {
+			break
+			fmt.Println("after break")
+		}
+	}
+	var a []int
+	fmt.Println(len(a))
+	return
+	fmt.Println(a[3])
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	x, y int
+}
+
+func show(p Point) {
+	fmt.Print("point ", p.x, " ", p.y, "\n")
+}
+
+func twice(n int) int {
+	fmt.Print("twice ", n, "\n")
+	return 2 * n
+}
+
+func loop(n int) {
+	for i := 0; i < n; i++ {
+		defer fmt.Print("iteration ", i, "\n")
+	}
+	fmt.Print("loop done\n")
+}
+
+func early(b bool) int {
+	defer fmt.Print("leaving early\n")
+	if b {
+		defer fmt.Print("early return\n")
+		return 1
+	}
+	fmt.Print("no early return\n")
+	return 0
+}
+
+func named(n int) (r int) {
+	defer twice(n)
+	r = n + 1
+	return
+}
+
+func main() {
+	defer fmt.Print("bye\n")
+	defer fmt.Println("second", "to", "last")
+	x := 1
+	defer fmt.Printf("x was %d\n", x)
+	x = 2
+	p := Point{1, 2}
+	defer show(p)
+	p.x = 10
+	defer twice(x)
+	loop(3)
+	fmt.Print(early(true), "\n")
+	fmt.Print(early(false), "\n")
+	fmt.Print(named(5), "\n")
+	fmt.Print("main done\n")
+}
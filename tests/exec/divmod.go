@@ -0,0 +1,24 @@
+package main
+
+import "fmt"
+
+func divmod(a, b int) (int, int) {
+	return a / b, a % b
+}
+
+func swap(s, t string) (string, string) {
+	return t, s
+}
+
+func main() {
+	q, r := divmod(17, 5)
+	fmt.Print(q, " ", r, "\n")
+	q, r = divmod(-17, 5)
+	fmt.Print(q, " ", r, "\n")
+	x, _ := divmod(100, 7)
+	fmt.Print(x, "\n")
+	a, b := swap("world", "hello")
+	fmt.Print(a, " ", b, "\n")
+	a, b = swap(swap(a, b))
+	fmt.Print(a, " ", b, "\n")
+}
@@ -0,0 +1,18 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Print("tab:\there\n")
+	fmt.Print("quote: \" backslash: \\\n")
+	fmt.Print("octal: \101\102\103\n")
+	fmt.Print("hex: \x41\x62\x63\n")
+	fmt.Print("utf-8: été \U0001F600 caf\xc3\xa9\n")
+	fmt.Print("bell and others: [\a\b\f\v\r]\n")
+	fmt.Print(`raw: \n is not a newline, "quotes" stay`, "\n")
+	fmt.Print(`multi
+line raw`, "\n")
+	fmt.Println("naïve déjà vu")
+	fmt.Println("same" == "s\x61me", "é" == "é", `\t` == "\\t")
+	fmt.Printf("%s|%d%%\n", "100%", 7)
+}
@@ -0,0 +1,18 @@
+package main
+import "fmt"
+func half(x float64) float64 { return x / 2.0 }
+func main() {
+	fmt.Print(1.5 + 2.25, "\n")
+	fmt.Print(3.14, "\n")
+	fmt.Print(.5, "\n")
+	fmt.Print(1e3, "\n")
+	fmt.Print(2.0, "\n")
+	fmt.Print(1e6, "\n")
+	fmt.Print(1.0 / 3.0, "\n")
+	fmt.Print(-2.5 * 4.0, "\n")
+	fmt.Print(1.5e-7, "\n")
+	var x float64 = 10.0
+	y := half(x) - 0.25
+	fmt.Print(y, "\n")
+	fmt.Println(x > y, x == 10.0, y <= 4.0, -x < 0.0)
+}
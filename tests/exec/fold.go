@@ -0,0 +1,29 @@
+package main
+
+import "fmt"
+
+const K = 7
+
+func f(s string) bool {
+	fmt.Print(s)
+	return true
+}
+
+func main() {
+	fmt.Print(2+3*4, "\n")
+	fmt.Print((K*2-4)/3%2, "\n")
+	fmt.Print(-(1 - 2*K), "\n")
+	fmt.Print(1.5*2.0-0.25, "\n")
+	fmt.Print(!(1 < 2) || 3 >= 3, "\n")
+	fmt.Print("abc" < "abd", "\n")
+	fmt.Print("go" == "go" && K != 7, "\n")
+	fmt.Print(false && f("not called\n"), "\n")
+	fmt.Print(true && f("called "), "\n")
+	fmt.Print(true || f("not called\n"), "\n")
+	fmt.Print(false || f("called "), "\n")
+	x := 10
+	fmt.Print(x*(2+3), "\n")
+	if 2*3 == 6 {
+		fmt.Print("folded condition\n")
+	}
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+func f(s string) int {
+	fmt.Println("call", s)
+	return 3
+}
+
+func main() {
+	a := f("a") * 0
+	b := 0 * f("b")
+	c := f("c") - f("d") + 2*3
+	d := false && f("e") > 0
+	e := true || f("f") > 0
+	g := 1 < 2 && f("g") == 3
+	fmt.Println(a, b, c, d, e, g)
+	for i := 0; i < 2*2; i += 1 << 1 {
+		fmt.Println(i, i*(4/2))
+	}
+}
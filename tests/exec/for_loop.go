@@ -0,0 +1,22 @@
+package main
+import "fmt"
+func main() {
+	for i := 0; i < 5; i++ {
+		fmt.Print(i, "\n")
+	}
+	n := 3
+	for n > 0 {
+		fmt.Print("n=", n, "\n")
+		n--
+	}
+	sum := 0
+	for j := 10; j > 0; j-- {
+		sum = sum + j
+	}
+	fmt.Print(sum, "\n")
+	k := 0
+	for ; k < 4; {
+		k++
+	}
+	fmt.Print("k=", k, "\n")
+}
@@ -0,0 +1,39 @@
+package main
+import "fmt"
+func add(a int, b int) int { return a + b }
+func sub(a, b int) int {
+	return a - b
+}
+func fact(n int) int {
+	if n <= 1 {
+		return 1
+	}
+	return n * fact(n - 1)
+}
+func even(n int) bool {
+	if n == 0 {
+		return true
+	}
+	return odd(n - 1)
+}
+func odd(n int) bool {
+	if n == 0 {
+		return false
+	}
+	return even(n - 1)
+}
+func greet(name string) {
+	fmt.Print("hello ", name, "\n")
+	return
+}
+func printf() { fmt.Print("not libc\n") }
+func main() {
+	fmt.Print(add(2, 3), "\n")
+	fmt.Print(sub(10, 4), "\n")
+	fmt.Print(fact(10), "\n")
+	fmt.Print(even(10), " ", odd(7), " ", even(3), "\n")
+	greet("go")
+	printf()
+	x := add(fact(3), sub(1, add(1, 1)))
+	fmt.Print(x, "\n")
+}
@@ -0,0 +1,113 @@
+package main
+
+import "fmt"
+
+// a loop written with gotos
+func sum(n int) int {
+	s := 0
+	i := 1
+loop:
+	if i > n {
+		goto done
+	}
+	s += i
+	i++
+	goto loop
+done:
+	return s
+}
+
+// the first pair of indices whose values add up to target
+func pair(a []int, target int) (int, int) {
+	i, j := -1, -1
+outer:
+	for x := 0; x < len(a); x++ {
+		for y := x + 1; y < len(a); y++ {
+			if a[x]+a[y] == target {
+				i, j = x, y
+				break outer
+			}
+		}
+	}
+	return i, j
+}
+
+// the numbers up to n with no divisor among the smaller ones
+func primes(n int) {
+next:
+	for p := 2; p <= n; p++ {
+		for d := 2; d*d <= p; d++ {
+			if p%d == 0 {
+				continue next
+			}
+		}
+		fmt.Print(p, " ")
+	}
+	fmt.Print("\n")
+}
+
+// a loop that only ends with a labeled break
+func first(s []string, w string) int {
+	i := 0
+search:
+	for {
+		switch {
+		case i == len(s):
+			i = -1
+			break search
+		case s[i] == w:
+			break search
+		}
+		i++
+	}
+	return i
+}
+
+func collatz(n int) int {
+	steps := 0
+	for {
+		if n == 1 {
+			goto end
+		}
+		if n%2 == 0 {
+			n /= 2
+		} else {
+			n = 3*n + 1
+		}
+		steps++
+	}
+end:
+	return steps
+}
+
+func main() {
+	fmt.Println(sum(10), sum(0))
+	fmt.Println(pair([]int{3, 8, 1, 5, 7}, 12))
+	fmt.Println(pair([]int{1, 2}, 7))
+	primes(30)
+	words := []string{"a", "b", "c"}
+	fmt.Println(first(words, "c"), first(words, "z"))
+	fmt.Println(collatz(27))
+	n := 0
+	goto skip
+skip:
+	n++
+	if n < 3 {
+		goto skip
+	}
+	fmt.Println(n)
+	{
+		k := 0
+	again:
+		k++
+		if k < 5 {
+			goto again
+		}
+		fmt.Println(k)
+	}
+end:
+	fmt.Println("end")
+	if n == 0 {
+		goto end
+	}
+}
@@ -0,0 +1,28 @@
+package main
+import "fmt"
+func main() {
+	x := 5
+	if x > 0 {
+		fmt.Print("pos\n")
+	} else {
+		fmt.Print("nonpos\n")
+	}
+	if x < 0 {
+		fmt.Print("neg\n")
+	} else if x == 0 {
+		fmt.Print("zero\n")
+	} else if x < 10 {
+		fmt.Print("small\n")
+	} else {
+		fmt.Print("big\n")
+	}
+	if x != 5 {
+		fmt.Print("unreachable\n")
+	}
+	y := 1
+	if true {
+		y := 2
+		fmt.Print(y, "\n")
+	}
+	fmt.Print(y, "\n")
+}
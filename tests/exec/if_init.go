@@ -0,0 +1,74 @@
+package main
+
+import "fmt"
+
+func compute(n int) int {
+	return n * n
+}
+
+func sign(n int) string {
+	if v := compute(n) - 10; v > 0 {
+		return "positive"
+	} else if w := v + 10; w == 0 {
+		return "zero"
+	} else {
+		return "negative"
+	}
+}
+
+func main() {
+	v := "outer"
+	if v := compute(3); v > 5 {
+		fmt.Println("then", v)
+	} else {
+		fmt.Println("else", v)
+	}
+	if v := compute(1); v > 5 {
+		fmt.Println("then", v)
+	} else {
+		v++
+		fmt.Println("else", v)
+	}
+	fmt.Println(v)
+
+	m := map[string]int{"a": 1}
+	if n, ok := m["a"]; ok {
+		fmt.Println("found", n)
+	}
+	if _, ok := m["b"]; !ok {
+		fmt.Println("missing")
+	}
+	x := 0
+	if x++; x == 1 {
+		fmt.Println("incremented", x)
+	}
+	fmt.Println(sign(4), sign(0), sign(2))
+
+	switch n := compute(2); n {
+	case 4:
+		fmt.Println("four")
+		fallthrough
+	case 5:
+		fmt.Println("after four", n)
+	default:
+		fmt.Println("other")
+	}
+	switch n := compute(5); {
+	case n > 20:
+		fmt.Println("big", n)
+	default:
+		fmt.Println("small", n)
+	}
+outer:
+	switch n := 1; n {
+	case 1:
+		for i := 0; i < 3; i++ {
+			if i == 1 {
+				break outer
+			}
+			fmt.Println("loop", i)
+		}
+		fmt.Println("not printed")
+	}
+	fmt.Println(v, x)
+}
@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+const Max = 9223372036854775807
+const Min = -9223372036854775808
+
+func main() {
+	fmt.Println(Max, Min)
+	fmt.Println(2147483647+1, 0x7fffffffffffffff)
+	fmt.Println(4294967296 * 2147483647)
+	x := Max
+	x = x + 1
+	fmt.Println(x, x == Min)
+	y := Min
+	y = y - 1
+	fmt.Println(y)
+	m := -1
+	fmt.Println(Min/m, Min%m, 7/m, -7%m)
+	z := 3037000500
+	fmt.Println(z * z)
+	fmt.Println(-7/2, -7%2, 7/-2, 7%-2)
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+const greeting = "héllo"
+
+func word() string {
+	fmt.Print("word called\n")
+	return "abc"
+}
+
+func main() {
+	fmt.Print(len("héllo"), " ", len(greeting), " ", len(""), "\n")
+	s := "hello, world"
+	fmt.Print(len(s), " ", len(s+"!"), " ", len(word()), "\n")
+
+	const n = len("four")
+	var a [n]int
+	p := &a
+	fmt.Print(len(a), " ", len(p), " ", len([2][3]bool{}), "\n")
+
+	var sl []int
+	fmt.Print(len(sl), " ")
+	sl = append(sl, 1, 2, 3)
+	fmt.Print(len(sl), "\n")
+}
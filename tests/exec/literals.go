@@ -0,0 +1,19 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Print(0xFF, "\n")
+	fmt.Print(0Xff, "\n")
+	fmt.Print(0x_7fff_ffff_ffff_ffff, "\n")
+	fmt.Print(0o17, "\n")
+	fmt.Print(0O777, "\n")
+	fmt.Print(017, "\n")
+	fmt.Print(00, "\n")
+	fmt.Print(0_600, "\n")
+	fmt.Print(0b1010, "\n")
+	fmt.Print(0B_1111_0000, "\n")
+	fmt.Print(1_000_000, "\n")
+	fmt.Print(0, "\n")
+	fmt.Print(-0x8000000000000000, "\n")
+}
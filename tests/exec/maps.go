@@ -0,0 +1,78 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func count(words []string) map[string]int {
+	m := map[string]int{}
+	for i := 0; i < len(words); i++ {
+		m[words[i]]++
+	}
+	return m
+}
+
+func main() {
+	m := map[string]int{}
+	m["a"] = 1
+	m["b"] = 2
+	v := m["a"]
+	fmt.Print(v, " ", m["b"], " ", len(m), "\n")
+
+	// a missing key gives the zero value
+	w, ok := m["missing"]
+	fmt.Print(w, " ", ok, "\n")
+	w, ok = m["b"]
+	fmt.Print(w, " ", ok, "\n")
+	_, ok = m["a"]
+	fmt.Print(ok, "\n")
+
+	// literals, printed in the order of their keys
+	ages := map[string]int{"bob": 31, "alice": 29, "carol": 40}
+	fmt.Print(ages, "\n")
+	delete(ages, "bob")
+	delete(ages, "dave")
+	fmt.Print(ages, " ", len(ages), "\n")
+
+	squares := map[int]int{}
+	for i := 0; i < 1000; i++ {
+		squares[i] = i * i
+	}
+	sum := 0
+	for i := 0; i < 1000; i++ {
+		sum += squares[i]
+	}
+	for i := 0; i < 1000; i += 2 {
+		delete(squares, i)
+	}
+	fmt.Print(sum, " ", len(squares), " ", squares[998], " ", squares[999], "\n")
+
+	// maps are references
+	c := count([]string{"go", "is", "fun", "go"})
+	d := c
+	d["is"] = 10
+	fmt.Print(c, "\n")
+
+	// strings, structures and slices as values
+	names := map[int]string{}
+	names[1] += "one"
+	fmt.Print(names[1], " [", names[2], "] ", len(names[2]), "\n")
+	points := map[string]Point{"o": {}, "p": {1, 2}}
+	p := points["p"]
+	p.X = 100
+	points["q"] = Point{Y: 3}
+	fmt.Print(points["p"], " ", p, " ", points, "\n")
+	lists := map[bool][]int{}
+	lists[true] = append(lists[true], 1, 2)
+	lists[false] = append(lists[false], 3)
+	lists[true][0] = 5
+	fmt.Print(lists, "\n")
+
+	var n map[string]int
+	fmt.Print(n == nil, " ", len(n), " ", n["x"], " ", n, "\n")
+	delete(n, "x")
+	fl := map[float64]bool{2.5: true, -1.5: false}
+	fmt.Print(fl, "\n")
+}
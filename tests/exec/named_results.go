@@ -0,0 +1,100 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+func split(sum int) (x int, y int) {
+	x = sum * 4 / 9
+	y = sum - x
+	return
+}
+
+// the results start at zero
+func zero() (n int, s string, b bool, f float64) {
+	return
+}
+
+func divmod(a, b int) (q, r int) {
+	if b == 0 {
+		return 0, a
+	}
+	q = a / b
+	r = a % b
+	return
+}
+
+// the current values are returned, not those of the first assignment
+func count(n int) (steps int) {
+	for n > 1 {
+		if n%2 == 0 {
+			n = n / 2
+		} else {
+			n = 3*n + 1
+		}
+		steps++
+	}
+	return
+}
+
+func move(dx int) (p Point) {
+	p.X = dx
+	p.Y = p.X * 2
+	return
+}
+
+func incr(p *int) {
+	*p = *p + 1
+}
+
+// the address of a named result may be taken
+func twice() (n int) {
+	incr(&n)
+	incr(&n)
+	return
+}
+
+func first() (_ int, ok bool) {
+	ok = true
+	return
+}
+
+func fill() (a [3]int, s []int) {
+	for i := 0; i < 3; i++ {
+		a[i] = i * i
+		s = append(s, a[i]+1)
+	}
+	return
+}
+
+// a shadowing variable is not a result
+func shadow() (x int) {
+	x = 1
+	{
+		x := 2
+		x++
+	}
+	return
+}
+
+func main() {
+	x, y := split(17)
+	fmt.Println(x, y)
+	n, s, b, f := zero()
+	fmt.Println(n, s == "", b, f)
+	q, r := divmod(17, 5)
+	fmt.Println(q, r)
+	q, r = divmod(17, 0)
+	fmt.Println(q, r)
+	fmt.Println(count(27))
+	p := move(3)
+	fmt.Println(p.X, p.Y)
+	fmt.Println(twice())
+	_, ok := first()
+	fmt.Println(ok)
+	a, sl := fill()
+	fmt.Println(a[2], sl[2], len(sl))
+	fmt.Println(shadow())
+}
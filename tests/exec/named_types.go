@@ -0,0 +1,77 @@
+package main
+
+import "fmt"
+
+type Celsius float64
+type Fahrenheit float64
+
+type ID int
+type Name = string
+
+type Scores []int
+type Point struct {
+	x, y int
+}
+type Origin Point
+
+type Nest []Nest
+type Link *Link
+
+func toFahrenheit(c Celsius) Fahrenheit {
+	return Fahrenheit(c*9.0/5.0 + 32.0)
+}
+
+func next(id ID) ID {
+	return id + 1
+}
+
+func sum(s Scores) int {
+	total := 0
+	for i := 0; i < len(s); i++ {
+		total += s[i]
+	}
+	return total
+}
+
+func greet(n Name) string {
+	return "hello, " + n
+}
+
+func main() {
+	boiling := Celsius(100)
+	var body Celsius = 37.5
+	fmt.Println(toFahrenheit(boiling), toFahrenheit(body), boiling > body)
+	fmt.Println(float64(body)+0.5, -body)
+
+	var id ID = 41
+	id = next(id)
+	id++
+	fmt.Println(id, int(id)*2, id == 43, ID(7)%4)
+
+	var s string = "world"
+	var n Name = s
+	fmt.Println(greet(n), greet("alias"), len(n))
+
+	scores := Scores{3, 4}
+	scores = append(scores, 5)
+	var plain []int = scores
+	fmt.Println(sum(scores), sum(plain), len(scores), scores[2])
+
+	ids := map[ID]string{1: "one"}
+	ids[ID(2)] = "two"
+	fmt.Println(len(ids), ids[2])
+
+	o := Origin{1, 2}
+	p := Point(o)
+	p.x = 10
+	fmt.Println(o.x, o.y, p.x)
+	fmt.Printf("%d %s %v %3d\n", id, n, id, ID(3))
+
+	nest := Nest{Nest{}, Nest{Nest{}, Nest{Nest{}}}}
+	nest = append(nest, nest[1][1])
+	fmt.Println(len(nest), len(nest[1]), len(nest[1][1][0]), len(nest[2]))
+	var l Link
+	var m Link = &l
+	l = m
+	fmt.Println(*l == m, *m == l, l != nil)
+}
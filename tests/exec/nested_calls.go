@@ -0,0 +1,37 @@
+package main
+
+import "fmt"
+
+func add(a, b int) int { return a + b }
+func mul(a, b int) int { return a * b }
+
+// the arguments are evaluated from left to right, with the calls they contain
+func trace(name string, n int) int {
+	fmt.Print(name, "=", n, " ")
+	return n
+}
+
+func bump(calls *int) int {
+	*calls++
+	return *calls
+}
+
+func pair(a int) (int, int) { return a, mul(a, a) }
+
+func report(calls int) { fmt.Println("calls:", calls) }
+
+func main() {
+	fmt.Print(add(mul(2, 3), 4), "\n")
+	fmt.Println(add(mul(add(1, 2), add(3, 4)), mul(add(5, 6), 2)))
+	fmt.Println(trace("a", add(trace("b", 1), trace("c", mul(trace("d", 2), 3)))))
+	c := 0
+	fmt.Println(mul(add(bump(&c), bump(&c)), add(bump(&c), mul(bump(&c), bump(&c)))))
+	fmt.Println(add(pair(add(1, mul(2, 3)))))
+	// the results of a call may be discarded
+	bump(&c)
+	pair(3)
+	trace("e", add(mul(1, 2), 3))
+	fmt.Println()
+	report(c)
+	fmt.Sprintf("%d", add(1, 2))
+}
@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+func main() {
+	x := 10
+	x += 5
+	fmt.Println(x)
+	x -= 1
+	fmt.Println(x)
+	x *= 2
+	fmt.Println(x)
+	x /= 3
+	fmt.Println(x)
+	x %= 4
+	fmt.Println(x)
+	x++
+	x++
+	x--
+	fmt.Println(x)
+
+	f := 1.5
+	f += 2.25
+	f *= 2.0
+	f -= 0.5
+	f /= 2.0
+	f++
+	fmt.Println(f)
+	f--
+	fmt.Println(f)
+
+	s := "ab"
+	s += "cd"
+	s += s
+	fmt.Println(s)
+
+	p := &x
+	*p += 100
+	fmt.Println(x)
+
+	for i := 0; i < 10; i += 3 {
+		fmt.Print(i, " ")
+	}
+	fmt.Println()
+}
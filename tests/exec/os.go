@@ -0,0 +1,27 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// the deferred calls of the callers are not made either
+func stop(code int) {
+	defer fmt.Println("not printed by stop")
+	fmt.Println("stopping")
+	os.Exit(code)
+}
+
+func main() {
+	defer fmt.Println("not printed by main")
+	fmt.Println(len(os.Args))
+	fmt.Println(os.Args[0] != "")
+	for i := 1; i < len(os.Args); i++ {
+		fmt.Println(os.Args[i])
+	}
+	args := os.Args
+	args[0] = "minigo"
+	fmt.Println(os.Args[0])
+	stop(0)
+	fmt.Println("not printed after os.Exit")
+}
@@ -0,0 +1,52 @@
+package main
+
+import "fmt"
+
+func set(p *int, v int) {
+	*p = v
+}
+
+func incr(p *int) {
+	*p++
+	*p += 10
+}
+
+func swap(a, b *int) {
+	*a, *b = *b, *a
+}
+
+func redirect(pp **int, p *int) {
+	*pp = p
+}
+
+func main() {
+	x := 5
+	p := &x
+	*p = 10
+	fmt.Print(x, "\n")
+
+	// writing through a parameter changes the caller's variable
+	set(&x, 20)
+	fmt.Print(x, " ", *p, "\n")
+	incr(p)
+	fmt.Print(x, "\n")
+
+	y := 1
+	swap(&x, &y)
+	fmt.Print(x, " ", y, "\n")
+
+	var q *int
+	fmt.Print(q == nil, "\n")
+	redirect(&q, &y)
+	*q = 42
+	fmt.Print(q == &y, " ", y, "\n")
+
+	// pointers to an element and to a boolean
+	a := [3]int{1, 2, 3}
+	set(&a[1], 7)
+	fmt.Print(a, "\n")
+	b := true
+	pb := &b
+	*pb = !*pb
+	fmt.Print(b, "\n")
+}
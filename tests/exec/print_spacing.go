@@ -0,0 +1,36 @@
+package main
+
+import "fmt"
+
+type Name string
+type Count int
+
+func pair() (int, int) {
+	return 3, 4
+}
+
+func main() {
+	fmt.Print(1, 2)
+	fmt.Print("\n")
+	fmt.Print("a", "b")
+	fmt.Print("\n")
+	fmt.Print(1, "x", 2)
+	fmt.Print("\n")
+	fmt.Print(1, 2, "x", 3, 4, "\n")
+	fmt.Print(true, false, 1.5, 'a', "\n")
+	fmt.Print("n=", 1, 2, "!", "\n")
+	x, y := pair()
+	fmt.Print(x, y, "\n")
+	var p *int
+	var s []int
+	fmt.Print(p, nil, s, []int{1, 2}, "\n")
+	n := Name("name")
+	c := Count(3)
+	fmt.Print(c, n, c, c, "\n")
+	fmt.Print(byte(65), rune(66), uint(7), "\n")
+	fmt.Print()
+	fmt.Print("", 1, "", 2, "\n")
+	fmt.Print(fmt.Sprintf("%d", 5), 6, "\n")
+	fmt.Println(1, "a", 2)
+	fmt.Print("end\n")
+}
@@ -0,0 +1,12 @@
+package main
+import "fmt"
+func main() {
+	fmt.Printf("x=%d ok=%t name=%s\n", 42, true, "go")
+	fmt.Printf("100%%\n")
+	fmt.Printf("%d%d%d\n", 1, 2, 3)
+	x := -5
+	b := x > 0
+	fmt.Printf("[%s] %d is positive: %t\n", "check", x, b)
+	fmt.Printf("%s", "no newline")
+	fmt.Printf("\n")
+}
@@ -0,0 +1,32 @@
+package main
+
+import "fmt"
+
+func main() {
+	r := 'é'
+	fmt.Printf("%c%c%c %c\n", 'G', 'o', '!', r)
+	fmt.Printf("%c|%c\n", 0x4E16, 128512)
+
+	x := 3054
+	fmt.Printf("%x %X %o %b\n", x, x, x, x)
+	fmt.Printf("%x %X %o %b\n", -x, -x, -x, -x)
+	fmt.Printf("%x %o %b\n", 0, 0, 0)
+	fmt.Printf("%x %b\n", -9223372036854775807-1, 9223372036854775807)
+	var b byte = 0xA5
+	var one uint = 1
+	u := one << 63
+	fmt.Printf("%x %b %o\n", b, b, b)
+	fmt.Printf("%x %o %X\n", u+u-1, u, u|0xF)
+
+	fmt.Printf("%v %v %v %v\n", 42, "text", true, -7)
+	fmt.Printf("%v %v %v\n", b, u, r)
+	f := 2.5
+	fmt.Printf("%v %v %v %v %v\n", f, -f/4, 1e6*f, 1.0/3, f*0)
+	fmt.Printf("[%6v|%-6v|%06v|%v]\n", f, f, -f, 1e-7)
+
+	s := fmt.Sprintf("%c=%x %b|%v", 'z', 'z', 5, false)
+	fmt.Println(s, len(s))
+	fmt.Println(fmt.Sprintf("%X-%o", -255, 8))
+	t := fmt.Sprintf("%v=%v", "f", f+0.25)
+	fmt.Println(t, len(t))
+}
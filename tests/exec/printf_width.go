@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+func main() {
+	fmt.Printf("[%5d][%-5d][%05d][%3d][%1d]\n", 42, 42, 42, 12345, 7)
+	fmt.Printf("[%05d][%6d][%-6d|][%0-6d|][%08d]\n", -42, -42, -42, -42, -9223372036854775807-1)
+	fmt.Printf("[%5x][%05x][%-6X|][%08b][%06o][%04x]\n", 255, -255, 255, 5, -8, 0)
+	fmt.Printf("[%8s][%-8s|][%05s][%2s][%6s]\n", "go", "go", "-ab", "long", "héllo")
+	fmt.Printf("[%6t][%-6v|][%3c][%05c][%5v][%05v]\n", true, false, 'é', 'a', "v", -3)
+	var u uint = 7
+	var b byte = 200
+	fmt.Printf("[%04d][%-4d|][%010v]\n", u, b, b)
+
+	// aligned columns
+	for i := 1; i <= 1000; i *= 10 {
+		fmt.Printf("%-6d|%6d|%06x|\n", i, i*i, i*i)
+	}
+	s := fmt.Sprintf("%3d|%-3d|%03d", 1, 2, -3)
+	fmt.Println(s, len(s))
+}
@@ -0,0 +1,11 @@
+package main
+import "fmt"
+func main() {
+	fmt.Println(1, 2, 3)
+	fmt.Println("a", "b", "c")
+	fmt.Println("x =", 42, true)
+	fmt.Println()
+	fmt.Println("alone")
+	x := 7
+	fmt.Println(x, x + 1, "end")
+}
@@ -0,0 +1,45 @@
+package main
+
+import "fmt"
+
+func next(r rune) rune { return r + 1 }
+
+func main() {
+	a := 'A'
+	fmt.Print(a, " ", next(a), " ", '\n', " ", '世', " ", '\x41', " ", 'é', " ", '\'', "\n")
+	fmt.Println(a+2, 'z'-a, a*2, a/2, a%7, -a)
+	var r rune = 'a' + 1
+	r++
+	r += 'a'
+	fmt.Println(r, r == 'a'+'c', r > 'a')
+	var b byte = 255
+	b++
+	fmt.Println(b)
+	b = 200
+	b = b + 100
+	fmt.Println(b)
+	b -= 45
+	fmt.Println(b, b*2)
+	var c byte = 'x'
+	fmt.Println(c, c-'a')
+	var big rune = 2147483647
+	big++
+	fmt.Println(big, -big)
+	n := 5 + 'a'
+	var m int = 'b'
+	fmt.Println(n, m, m+'0')
+	bs := []byte{'h', 'i', 33}
+	rs := [3]rune{'a', 'é'}
+	fmt.Println(bs, rs, len(bs))
+	count := map[rune]int{}
+	count['x']++
+	count['x'] += 2
+	fmt.Println(count)
+	switch a {
+	case 'A':
+		fmt.Println("is A")
+	case 'B':
+		fmt.Println("is B")
+	}
+	fmt.Printf("%d %d\n", a, b)
+}
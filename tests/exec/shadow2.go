@@ -0,0 +1,40 @@
+package main
+
+import "fmt"
+
+func pair(n int) (int, int) {
+	return n, n * n
+}
+
+func main() {
+	x := 1
+	fmt.Println(x)
+	{
+		x := "inner"
+		fmt.Println(x)
+		{
+			x := 2.5
+			fmt.Println(x)
+		}
+		fmt.Println(x)
+	}
+	fmt.Println(x)
+
+	for x := 10; x < 12; x++ {
+		fmt.Println(x)
+	}
+	fmt.Println(x)
+
+	// := assigns the variables of the same scope, and declares the others
+	x, y := pair(3)
+	fmt.Println(x, y)
+	{
+		x, z := pair(4)
+		y, z = z, y
+		fmt.Println(x, y, z)
+	}
+	fmt.Println(x, y)
+	var name string
+	name, n := "b", 1
+	fmt.Println(name, n)
+}
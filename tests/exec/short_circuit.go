@@ -0,0 +1,24 @@
+package main
+import "fmt"
+func loud(name string, b bool) bool {
+	fmt.Print("called ", name, "\n")
+	return b
+}
+func main() {
+	if false && loud("and", true) {
+		fmt.Print("wrong\n")
+	}
+	if true || loud("or", true) {
+		fmt.Print("or skipped\n")
+	}
+	if true && loud("and2", false) {
+		fmt.Print("wrong\n")
+	}
+	if false || loud("or2", true) {
+		fmt.Print("or evaluated\n")
+	}
+	x := 0
+	b := x != 0 && 10 / x > 1
+	fmt.Println(b, !b, !(x == 0), !true || !false)
+	fmt.Println(true && false || true, true && (false || true), !(true && true))
+}
@@ -0,0 +1,56 @@
+package main
+
+import "fmt"
+
+func squares(n int) []int {
+	var s []int
+	for i := 0; i < n; i++ {
+		s = append(s, i*i)
+	}
+	return s
+}
+
+func main() {
+	s := []int{}
+	fmt.Print(len(s), " ", s, "\n")
+	s = append(s, 42)
+	fmt.Print(len(s), " ", s[0], "\n")
+	s = append(s, 1, 2, 3)
+	fmt.Print(len(s), " ", s, "\n")
+	s[1] = s[0] + s[3]
+	fmt.Print(s, "\n")
+
+	q := squares(10)
+	fmt.Print(len(q), " ", q, "\n")
+
+	var nilSlice []string
+	fmt.Print(len(nilSlice), " ", nilSlice, " ", nilSlice == nil, "\n")
+	words := append(nilSlice, "hello", "world")
+	fmt.Print(words, " ", nilSlice, " ", words == nil, "\n")
+	words = nil
+	fmt.Print(len(words), "\n")
+
+	// a slice shares its elements with the slices it was appended from,
+	// as long as they fit in its capacity
+	a := []int{1, 2}
+	b := append(a, 3)
+	b[0] = 10
+	fmt.Print(a, " ", b, "\n")
+
+	grid := [][]bool{{true}, {false, true}}
+	grid = append(grid, []bool{})
+	grid[2] = append(grid[2], true, true, false)
+	fmt.Print(len(grid), " ", grid, "\n")
+
+	pairs := [][2]int{{1, 2}}
+	p := [2]int{3, 4}
+	pairs = append(pairs, p)
+	p[0] = 0
+	fmt.Print(pairs, " ", p, "\n")
+
+	sum := 0
+	for i := 0; i < len(q); i++ {
+		sum += q[i]
+	}
+	fmt.Print(sum, "\n")
+}
@@ -0,0 +1,26 @@
+package main
+
+import "fmt"
+
+func label(name string, n int) string {
+	return fmt.Sprintf("%s#%d", name, n)
+}
+
+func main() {
+	s := fmt.Sprintf("x=%d", 42)
+	fmt.Print(s, "\n")
+	empty := fmt.Sprintf("")
+	fmt.Print("[", empty, "]\n")
+	fmt.Print(fmt.Sprintf("no verbs, 100%%"), "\n")
+	fmt.Println(label("item", 7), label("item", 7) == "item#7")
+	t := fmt.Sprintf("%t and %t", true, false)
+	fmt.Println(t, nonEmpty(t))
+	fmt.Printf("%s|%s\n", fmt.Sprintf("%d%d", 1, 2), fmt.Sprintf("%s", "nested"))
+	if fmt.Sprintf("%d", -5) < fmt.Sprintf("%d", 3) {
+		fmt.Println("compared")
+	}
+}
+
+func nonEmpty(s string) bool {
+	return s != ""
+}
@@ -0,0 +1,79 @@
+package main
+
+import "fmt"
+
+type Point struct {
+	X, Y int
+}
+
+type Segment struct {
+	From, To Point
+	Name     string
+}
+
+type Path struct {
+	Points [3]Point
+	Length int
+}
+
+func move(p Point, dx int) Point {
+	p.X = p.X + dx
+	return p
+}
+
+func origin() Segment {
+	return Segment{Name: "origin"}
+}
+
+func shift(p *Point) {
+	p.Y++
+}
+
+func main() {
+	p := Point{X: 1, Y: 2}
+	q := Point{3, 4}
+	fmt.Print(p, " ", q, "\n")
+
+	// missing fields are zero
+	r := Point{Y: 5}
+	fmt.Print(r.X, " ", r.Y, "\n")
+
+	// structures are copied when passed, returned and assigned
+	m := move(p, 10)
+	fmt.Print(p.X, " ", m.X, "\n")
+	c := q
+	c.X = 30
+	fmt.Print(q.X, " ", c.X, "\n")
+
+	// nested structures
+	s := Segment{From: p, To: Point{5, 6}, Name: "s"}
+	s.To.Y = 60
+	p.X = 100
+	fmt.Print(s.From.X, " ", s.To.Y, " ", s.Name, "\n")
+	fmt.Print(s, "\n")
+	o := origin()
+	fmt.Print(o.Name, " ", o.To.X, " [", o, "]\n")
+
+	var z Segment
+	fmt.Print(len(z.Name), "\n")
+
+	// pointers share the structure
+	pp := &Point{7, 8}
+	shift(pp)
+	shift(&q)
+	fmt.Print(pp.Y, " ", q.Y, " ", pp, "\n")
+
+	// arrays and slices of structures
+	path := Path{Points: [3]Point{{1, 1}, {2, 2}}, Length: 2}
+	path.Points[2] = Point{3, 3}
+	fmt.Print(path, "\n")
+	ps := []Point{{1, 2}, {X: 3}}
+	ps = append(ps, q)
+	ps[0].X = 9
+	fmt.Print(ps, " ", len(ps), "\n")
+
+	// a literal in a condition is parenthesized
+	if (Point{1, 2}).Y == 2 {
+		fmt.Print("ok\n")
+	}
+}
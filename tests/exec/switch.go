@@ -0,0 +1,88 @@
+package main
+
+import "fmt"
+
+func name(n int) string {
+	switch n {
+	case 1:
+		return "one"
+	case 2, 3:
+		return "two or three"
+	default:
+		return "many"
+	}
+}
+
+func sign(x int) int {
+	switch {
+	case x < 0:
+		return -1
+	case x > 0:
+		return 1
+	}
+	return 0
+}
+
+func next() int {
+	fmt.Println("tag evaluated")
+	return 2
+}
+
+func main() {
+	for i := 0; i < 5; i++ {
+		fmt.Println(i, name(i))
+	}
+	fmt.Println(sign(-5), sign(0), sign(7))
+
+	switch next() {
+	case 1:
+		fmt.Println("1")
+	case 2:
+		fmt.Println("2")
+		fallthrough
+	case 3:
+		fmt.Println("3 after fallthrough")
+	case 4:
+		fmt.Println("4 never")
+	}
+
+	switch {
+	}
+
+	switch "b" {
+	default:
+		fmt.Println("default first")
+		fallthrough
+	case "a":
+		fmt.Println("a after default")
+	case "b":
+		fmt.Println("b")
+	}
+
+	for i := 0; i < 6; i++ {
+		switch {
+		case i == 1:
+			continue
+		case i == 4:
+			break
+		case i%2 == 0:
+			fmt.Println("even", i)
+			if i > 1 {
+				break
+			}
+			fmt.Println("zero")
+		}
+		if i == 5 {
+			break
+		}
+		fmt.Println("end of iteration", i)
+	}
+
+	x := 1.5
+	switch x {
+	case 0.5:
+		fmt.Println("half")
+	case 1.5:
+		fmt.Println("one and a half")
+	}
+}
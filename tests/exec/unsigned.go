@@ -0,0 +1,48 @@
+package main
+
+import "fmt"
+
+func half(x uint) uint {
+	return x / 2
+}
+
+func main() {
+	var x uint8 = 255
+	x++
+	fmt.Println(x)
+	x--
+	fmt.Println(x, x+1, x*2, x<<1)
+
+	var h uint16 = 65535
+	h += 2
+	fmt.Println(h)
+	var w uint32 = 1 << 31
+	fmt.Println(w*2, w-1, w/3, w%7)
+
+	// the top bit of a uint is not a sign
+	var zero uint
+	big := ^zero
+	fmt.Println(big, big/10, big%10, big>>60, half(big))
+	var s uint = 63
+	n := uint64(1) << s
+	m := uint(1) << s
+	fmt.Println(big > 1, big < 1, big >= m, m <= big, n > 1<<62)
+	fmt.Println(n, n-1, n+n, n/3, n%1000)
+	fmt.Printf("%d %d\n", big, n)
+	// nor the top bit of a constant
+	const top = uint64(1) << 63
+	fmt.Println(^uint(0), top, ^uint(0)/10, top>>62, ^uint64(0) > top, uint64(1.5e19))
+
+	// conversions keep the bits, and wrap around to the narrower types
+	i := -1
+	fmt.Println(uint(i), uint8(i), uint16(i), uint32(i))
+	fmt.Println(int(big), int8(x), int(uint8(200)), uint8(300+i))
+	fmt.Println(float64(big), float64(n), uint(float64(m)), uint64(float64(n)+1e4), uint(3.0e18))
+
+	s = 3
+	fmt.Println(1<<s, -16>>s, big>>s, x>>s)
+	for k := uint(0); k < 4; k++ {
+		fmt.Print(k, " ")
+	}
+	fmt.Println()
+}
@@ -0,0 +1,54 @@
+package main
+
+import "fmt"
+
+func sum(nums ...int) int {
+	total := 0
+	for i := 0; i < len(nums); i++ {
+		total += nums[i]
+	}
+	return total
+}
+
+func join(sep string, words ...string) string {
+	s := ""
+	for i := 0; i < len(words); i++ {
+		if i > 0 {
+			s += sep
+		}
+		s += words[i]
+	}
+	return s
+}
+
+func count(prefix string, xs ...float64) {
+	fmt.Print(prefix, len(xs), " ", xs == nil, "\n")
+}
+
+func forward(nums ...int) int {
+	return sum(nums...) * 2
+}
+
+func grow(s ...byte) []byte {
+	return append(s, 'z')
+}
+
+func main() {
+	fmt.Print(sum(1, 2, 3), "\n")
+	fmt.Print(sum(), "\n")
+	fmt.Print(sum(42), "\n")
+	s := []int{10, 20, 30}
+	fmt.Print(sum(s...), "\n")
+	s = append(s, 40)
+	fmt.Print(sum(s...), " ", forward(s...), "\n")
+	fmt.Print(join(", ", "a", "b", "c"), "\n")
+	fmt.Print(join("-"), "|\n")
+	words := []string{"x", "y"}
+	fmt.Print(join("+", words...), "\n")
+	count("none ")
+	count("two ", 1.5, 2.0)
+	b := grow('a', 'b')
+	fmt.Print(len(b), " ", string(b[2]), "\n")
+	defer fmt.Print(sum(1, 1), "\n")
+	defer sum(s...)
+}
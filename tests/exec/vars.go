@@ -0,0 +1,18 @@
+package main
+import "fmt"
+func main() {
+	x := 42
+	var y int = 10
+	var z int
+	var b = true
+	s := "go"
+	var t, u string = "a", "b"
+	fmt.Print(x, "\n")
+	fmt.Print(y, "\n")
+	fmt.Print(z, "\n")
+	fmt.Print(b, "\n")
+	fmt.Print(s, "\n")
+	fmt.Print(t, u, "\n")
+	x = x + y
+	fmt.Print(x, "\n")
+}
@@ -0,0 +1,15 @@
+package main
+
+import "fmt"
+
+type Celsius float64
+type Small int8
+
+const K = 1 << 10
+
+func main() {
+	fmt.Println(6*7, 100/7, 100%7, -(3 << 4), ^5, K>>3)
+	fmt.Println(Small(100)/3*-1, int(K)*K, uint8(200)>>2, 7&^5|8)
+	fmt.Println(Celsius(1.5)*4, 10.0/4, 2.5*-2-1)
+	fmt.Println(7 > 3, 6*7 == 42, !(1 < 2) || 2 >= 2, "a" < "b")
+}
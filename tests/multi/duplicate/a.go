@@ -0,0 +1,11 @@
+package main
+
+import "fmt"
+
+func twice(x int) int {
+	return 2 * x
+}
+
+func main() {
+	fmt.Println(twice(21))
+}
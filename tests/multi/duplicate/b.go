@@ -0,0 +1,5 @@
+package main
+
+func twice(x int) int {
+	return x + x
+}
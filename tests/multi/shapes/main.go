@@ -0,0 +1,14 @@
+package main
+
+import "fmt"
+
+// uses the type, the functions and the constants of shapes.go
+
+func main() {
+	r := Rect{Width: 3, Height: 4}
+	fmt.Println(area(r), perimeter(r))
+	for i := 0; i < Sides; i++ {
+		r = grow(r)
+	}
+	fmt.Println(r.Width, r.Height, describe(r))
+}
@@ -0,0 +1,28 @@
+package main
+
+const Sides = 4
+
+type Rect struct {
+	Width, Height int
+}
+
+func area(r Rect) int {
+	return r.Width * r.Height
+}
+
+func perimeter(r Rect) int {
+	return 2 * (r.Width + r.Height)
+}
+
+func grow(r Rect) Rect {
+	r.Width++
+	r.Height++
+	return r
+}
+
+func describe(r Rect) string {
+	if area(r) > 50 {
+		return "large"
+	}
+	return "small"
+}
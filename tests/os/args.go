@@ -0,0 +1,19 @@
+package main
+
+import (
+	"fmt"
+	"os"
+)
+
+// exits with the number of its arguments, os.Args[0] apart
+func main() {
+	defer fmt.Println("printed without arguments only")
+	n := len(os.Args) - 1
+	for i := 1; i <= n; i++ {
+		fmt.Println(i, os.Args[i], len(os.Args[i]))
+	}
+	if n > 0 {
+		os.Exit(n)
+	}
+	fmt.Println("no arguments")
+}
@@ -0,0 +1,18 @@
+	.text
+main:
+	pushq %rax
+L_1:
+	popq %rax
+	movq $1, %rax
+# a comment
+	movq $2, %rax
+	movq %rax, -8(%rbp)
+	.loc 1 4 2
+	movq -8(%rbp), %rax
+	movq %rax, %rbx	# kept with its comment
+	movq %rbx, %rax
+	pushq   %rbp
+	movq    %rsp, %rbp
+	movq    %rbp, %rsp
+	popq    %rbp
+	ret
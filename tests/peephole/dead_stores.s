@@ -0,0 +1,16 @@
+	.text
+main:
+	movq $0, %rax
+	movq $1, %rax
+	movq %rdi, %rsi
+	movq -8(%rbp), %rsi
+	movq %rax, -8(%rbp)
+	movq %rbx, -8(%rbp)
+	movq $3, %rcx
+	movq 8(%rcx), %rcx
+	movq -24(%rbp), %rdx
+	movq $5, %rdx
+	movq $6, %rax
+	addq $1, %rax
+	movq $7, %rax
+	ret
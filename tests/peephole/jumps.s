@@ -0,0 +1,19 @@
+	.text
+main:
+	jmp L_1
+L_1:
+	cmpq $0, %rax
+	je L_2
+L_2:
+	jmp L_3
+	jmp L_3
+L_3:
+	jmp L_5
+L_4:
+L_5:
+	jmp *%rax
+	testq %rax, %rax
+	jne .Lnext
+.Lnext:
+	jmp L_1
+	ret
@@ -0,0 +1,18 @@
+	.text
+main:
+	movq %rax, %rax
+	movl %eax, %eax
+	movq %rax, -8(%rbp)
+	movq -8(%rbp), %rax
+	movq -16(%rbp), %rcx
+	movq %rcx, -16(%rbp)
+	movq %rax, %rbx
+	movq %rbx, %rax
+	movq %rax, 8(%rax)
+	movq 8(%rax), %rax
+	movq (%rcx), %rcx
+	movq %rcx, (%rcx)
+	movq %rdi, %r12
+	movq %r12, %xmm0
+	movq %xmm0, %r12
+	ret
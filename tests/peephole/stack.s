@@ -0,0 +1,22 @@
+	.text
+main:
+	pushq %rax
+	popq %rax
+	pushq %rax
+	popq %rsi
+	pushq $42
+	popq %rdi
+	pushq %rax
+	pushq %rbx
+	popq %rbx
+	popq %rax
+	pushq %rax
+	movq $1, %rbx
+	popq %rax
+	pushq 8(%rbp)
+	popq %rcx
+	pushq %rsp
+	popq %rax
+	pushq %rax
+	popq %rsp
+	ret
@@ -22,29 +22,88 @@ let separate_declarations dl =
   in
   (structs, functions)
 
-let file ~debug:b ((imp, dl) : Ast.pfile) : Tast.tfile =
+(** A location that only names [file], for the errors that concern a whole
+    file *)
+let file_loc file =
+  let pos = { Lexing.dummy_pos with pos_fname = file } in
+  (pos, pos)
+
+(** The files of the package are typed together: the functions, types and
+    constants declared in one of them are visible in all the others, but
+    each file must import fmt and os to use them *)
+let file ~debug:b (files : (string * Ast.pfile) list) : Tast.tfile =
   debug := b;
-  fmt_print_used := false;
 
+  let dl = List.concat_map (fun (_, (_, dl)) -> dl) files in
   let list_of_structs, list_of_functions = separate_declarations dl in
 
   (* Validate: check for duplicates *)
   Validation.check_no_duplicate_functions list_of_functions;
   Validation.check_no_duplicate_structs list_of_structs;
+  Validation.check_no_duplicate_types dl;
+  Hashtbl.reset Types.declared;
+  Hashtbl.reset Types.named;
+  List.iter
+    (function
+      | PDtype t -> Hashtbl.replace Types.declared t.pt_name.id t | _ -> ())
+    dl;
+
+  (* Package-level constants are visible in every function, and in the
+     array lengths of the types *)
+  let globals = VarEnv.empty () in
+  DeclTypecheck.constants globals fmt_print_used dl;
+  let length = DeclTypecheck.array_length globals fmt_print_used in
 
   (* Build environments *)
-  let struct_env = EnvBuilder.build_struct_env list_of_structs ~debug:!debug in
-  Validation.check_struct_cycles list_of_structs;
+  let struct_env =
+    EnvBuilder.build_struct_env ~length list_of_structs ~debug:!debug
+  in
+  Validation.check_struct_cycles list_of_structs
+    (List.filter_map (function PDtype t -> Some t | _ -> None) dl);
 
-  let func_env = EnvBuilder.build_func_env struct_env list_of_functions imp in
+  (* the types that no declaration refers to are checked as well *)
+  List.iter
+    (function
+      | PDtype t when not (Hashtbl.mem Types.named t.pt_name.id) ->
+          ignore (Types.resolve ~length struct_env t)
+      | _ -> ())
+    dl;
+
+  let func_env =
+    EnvBuilder.build_func_env ~length struct_env list_of_functions false
+  in
 
-  (* Typecheck all declarations *)
-  let typed_decls =
-    List.map (DeclTypecheck.declaration struct_env func_env fmt_print_used !debug) dl
+  (* Typecheck all declarations, file by file *)
+  let file (name, (imports, dl)) =
+    Validation.check_no_duplicate_imports imports;
+    let imported package = List.find_opt (fun p -> p.id = package) imports in
+    fmt_print_used := false;
+    Typing_expr.ExprTypecheck.os_used := false;
+    let func_env =
+      if imports <> [] then begin
+        let env = Hashtbl.copy func_env in
+        List.iter
+          (fun p -> EnvBuilder.add_builtin_functions ~package:p.id env)
+          imports;
+        env
+      end
+      else func_env
+    in
+    let typed_decls =
+      List.filter_map
+        (DeclTypecheck.declaration ~length struct_env func_env globals
+           fmt_print_used !debug)
+        dl
+    in
+    Validation.check_fmt_import_used ~loc:(file_loc name)
+      (imported "fmt" <> None) !fmt_print_used;
+    Validation.check_os_import_used (imported Constants.os_package)
+      !Typing_expr.ExprTypecheck.os_used;
+    typed_decls
   in
+  let typed_decls = List.concat_map file files in
 
   (* Final validations *)
-  Validation.check_fmt_import_used imp !fmt_print_used;
   Validation.check_main_signature func_env;
 
   typed_decls
\ No newline at end of file
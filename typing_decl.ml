@@ -29,7 +29,12 @@ module DeclTypecheck = struct
            (List.map (fun v -> Types.to_string v.v_typ) func_def.fn_params))
         (String.concat ", " (List.map Types.to_string func_def.fn_typ))
 
-  let function_ struct_env func_env fmt_print_used debug (f : pfunc) :
+  (* the last character of a block *)
+  let closing_brace (b : pexpr) =
+    let _, e = b.pexpr_loc in
+    ({ e with Lexing.pos_cnum = e.Lexing.pos_cnum - 1 }, e)
+
+  let function_ struct_env func_env globals fmt_print_used debug (f : pfunc) :
       function_ * expr =
     Validation.check_no_duplicate_params f;
 
@@ -39,22 +44,54 @@ module DeclTypecheck = struct
       | None -> errorm ~loc:f.pf_name.loc "undefined function: %s" f.pf_name.id
     in
 
-    let var_env = VarEnv.empty in
+    let var_env = VarEnv.push_scope globals in
     List.iter (VarEnv.add_var var_env) func_def.fn_params;
 
-    let ctx = make_context struct_env func_env var_env func_def.fn_typ in
-    let typed_body = typecheck_expr ctx fmt_print_used f.pf_body in
+    (* named results are zero-valued locals of the body, that need not be
+       used *)
+    let results =
+      List.mapi
+        (fun i (ident, typ) ->
+          let name =
+            if Constants.is_blank ident.id then Constants.blank_result i
+            else ident.id
+          in
+          let v = new_var name ident.loc typ in
+          v.v_used <- true;
+          if not (Constants.is_blank ident.id) then VarEnv.add_var var_env v;
+          v)
+        (List.combine f.pf_results func_def.fn_typ)
+    in
 
+    let ctx =
+      {
+        (make_context struct_env func_env var_env func_def.fn_typ) with
+        results;
+      }
+    in
+    Validation.check_labels f;
+    let typed_body = function_body ctx fmt_print_used f.pf_body in
+
+    (* reported on the closing brace, as Go does *)
     if List.length func_def.fn_typ > 0 && not (always_returns typed_body) then
-      errorm ~loc:f.pf_name.loc "Not all paths of function: %s return"
-        func_def.fn_name;
+      errorm ~loc:(closing_brace f.pf_body) "missing return";
+
+    let typed_body =
+      match results with
+      | [] -> typed_body
+      | _ ->
+          let vars =
+            { expr_desc = TEvars results; expr_typ = ResultType.empty }
+          in
+          { typed_body with expr_desc = TEblock [ vars; typed_body ] }
+    in
 
     check_unused_variables func_def typed_body;
     print_function_signature func_def debug;
 
     (func_def, typed_body)
 
-  let structure struct_env (s : pstruct) : structure =
+  let structure ~length struct_env (s : pstruct) : structure =
     Validation.check_no_duplicate_fields s;
 
     let fields_list =
@@ -62,7 +99,7 @@ module DeclTypecheck = struct
         (fun (ident, ptyp) ->
           {
             f_name = ident.id;
-            f_typ = Types.from_ptyp struct_env ptyp;
+            f_typ = Types.from_ptyp ~length struct_env ptyp;
             f_ofs = 0;
           })
         s.ps_fields
@@ -80,11 +117,31 @@ module DeclTypecheck = struct
       s_size = 0;
     }
 
-  let declaration struct_env func_env fmt_print_used debug = function
-    | PDstruct s -> TDstruct (structure struct_env s)
+  (** Package-level constants, bound in [globals] before anything else since
+      the types of the other declarations may use them as array lengths *)
+  let constants globals fmt_print_used dl =
+    let ctx = make_context (Hashtbl.create 0) (Hashtbl.create 0) globals [] in
+    List.iter
+      (function
+        | PDconsts cl ->
+            ignore
+              (ExprTypecheck.consts
+                 (fun ctx -> typecheck_expr ctx fmt_print_used)
+                 ctx cl)
+        | _ -> ())
+      dl
+
+  let array_length globals fmt_print_used =
+    let ctx = make_context (Hashtbl.create 0) (Hashtbl.create 0) globals [] in
+    array_length ctx fmt_print_used
+
+  let declaration ~length struct_env func_env globals fmt_print_used debug =
+    function
+    | PDstruct s -> Some (TDstruct (structure ~length struct_env s))
     | PDfunction f ->
         let func_def, typed_body =
-          function_ struct_env func_env fmt_print_used debug f
+          function_ struct_env func_env globals fmt_print_used debug f
         in
-        TDfunction (func_def, typed_body)
+        Some (TDfunction (func_def, typed_body))
+    | PDtype _ | PDconsts _ -> None
 end
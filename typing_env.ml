@@ -26,13 +26,16 @@ let new_var x loc ty =
     v_used = false;
     v_addr = false;
     v_ofs = -1;
+    v_const = None;
   }
 
+let new_const x loc ty c = { (new_var x loc ty) with v_const = Some c }
+
 (** Variable environment module *)
 module VarEnv = struct
   type t = (string, var) Hashtbl.t list
 
-  let empty : t = [ Hashtbl.create 10 ]
+  let empty () : t = [ Hashtbl.create 10 ]
   let push_scope (env : t) : t = Hashtbl.create 10 :: env
 
   let pop_scope (env : t) : t =
@@ -61,10 +64,6 @@ module VarEnv = struct
     | Some v -> v
     | None -> errorm ~loc "undefined variable: %s" name
 
-  let check_not_blank v loc =
-    if Constants.is_blank v.v_name then
-      errorm ~loc "cannot use blank identifier '_' as variable"
-
   let is_already_declared env name =
     match find_current_scope env name with
     | Some v when not (Constants.is_blank v.v_name) -> true
@@ -81,18 +80,22 @@ module EnvBuilder = struct
       s_size = 0;
     }
 
-  let create_field struct_env (fname, ftyp) : field =
-    { f_name = fname.id; f_typ = Types.from_ptyp struct_env ftyp; f_ofs = 0 }
+  let create_field ~length struct_env (fname, ftyp) : field =
+    {
+      f_name = fname.id;
+      f_typ = Types.from_ptyp ~length struct_env ftyp;
+      f_ofs = 0;
+    }
 
-  let populate_struct_fields struct_env (s : pstruct) (structure : structure) :
-      unit =
-    let fields = List.map (create_field struct_env) s.ps_fields in
+  let populate_struct_fields ~length struct_env (s : pstruct)
+      (structure : structure) : unit =
+    let fields = List.map (create_field ~length struct_env) s.ps_fields in
     List.iter
       (fun field -> Hashtbl.add structure.s_fields field.f_name field)
       fields;
     structure.s_list <- fields
 
-  let build_struct_env (structs : pstruct list) ~debug : struct_env =
+  let build_struct_env ~length (structs : pstruct list) ~debug : struct_env =
     let struct_env = Hashtbl.create (List.length structs) in
 
     (* Add empty structures first *)
@@ -104,7 +107,7 @@ module EnvBuilder = struct
     List.iter
       (fun s ->
         let structure = Hashtbl.find struct_env s.ps_name.id in
-        populate_struct_fields struct_env s structure)
+        populate_struct_fields ~length struct_env s structure)
       structs;
 
     if debug then
@@ -114,29 +117,41 @@ module EnvBuilder = struct
 
     struct_env
 
-  let create_param struct_env (ident, ptyp) : var =
-    let param_type = Types.from_ptyp struct_env ptyp in
+  let create_param ~length struct_env (ident, ptyp) : var =
+    let param_type = Types.from_ptyp ~length struct_env ptyp in
     new_var ident.id ident.loc param_type
 
-  let create_function struct_env (f : pfunc) : function_ =
+  let create_function ~length struct_env (f : pfunc) : function_ =
     {
       fn_name = f.pf_name.id;
-      fn_params = List.map (create_param struct_env) f.pf_params;
-      fn_typ = List.map (Types.from_ptyp struct_env) f.pf_typ;
+      fn_params = List.map (create_param ~length struct_env) f.pf_params;
+      fn_typ = List.map (Types.from_ptyp ~length struct_env) f.pf_typ;
+      fn_loc = f.pf_name.loc;
+      fn_variadic = f.pf_variadic;
     }
 
-  let add_builtin_functions func_env =
-    Hashtbl.add func_env Constants.fmt_print
-      { fn_name = Constants.fmt_print; fn_params = []; fn_typ = [] }
-
-  let build_func_env (struct_env : struct_env) (funcs : pfunc list)
+  let add_builtin_functions ?(package = "fmt") func_env =
+    List.iter
+      (fun name ->
+        Hashtbl.add func_env name
+          {
+            fn_name = name;
+            fn_params = [];
+            fn_typ = [];
+            fn_loc = dummy_loc;
+            fn_variadic = false;
+          })
+      (Constants.package_functions package)
+
+  let build_func_env ~length (struct_env : struct_env) (funcs : pfunc list)
       (has_import : bool) : func_env =
     let func_env = Hashtbl.create (List.length funcs) in
 
     (* Add user-defined functions *)
     List.iter
       (fun f ->
-        Hashtbl.add func_env f.pf_name.id (create_function struct_env f))
+        Hashtbl.add func_env f.pf_name.id
+          (create_function ~length struct_env f))
       funcs;
 
     (* Add builtin functions *)
@@ -150,10 +165,23 @@ type typing_context = {
   funcs : func_env;
   vars : VarEnv.t;
   expected_return : typ list;
+  results : var list; (** named results, returned by a naked return *)
+  in_loop : bool; (** continue is allowed *)
+  in_switch : bool; (** break is allowed, even outside of a loop *)
+  iota : int option; (** inside a const declaration *)
 }
 (** Typing context containing all environments and expected return types *)
 
 let make_context structs funcs vars expected_return =
-  { structs; funcs; vars; expected_return }
+  {
+    structs;
+    funcs;
+    vars;
+    expected_return;
+    results = [];
+    in_loop = false;
+    in_switch = false;
+    iota = None;
+  }
 
 let push_scope_ctx ctx = { ctx with vars = VarEnv.push_scope ctx.vars }
\ No newline at end of file
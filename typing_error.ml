@@ -6,4 +6,8 @@ let dummy_loc = (Lexing.dummy_pos, Lexing.dummy_pos)
 exception Error of Ast.location * string
 
 let errorm ?(loc = dummy_loc) f =
-  Format.kasprintf (fun s -> raise (Error (loc, s))) ("@[" ^^ f ^^ "@]")
\ No newline at end of file
+  Format.kasprintf (fun s -> raise (Error (loc, s))) ("@[" ^^ f ^^ "@]")
+
+(** file:line:col of [loc], to point at another declaration in a message *)
+let string_of_loc ((b, _) : Ast.location) =
+  sprintf "%s:%d:%d" b.Lexing.pos_fname b.pos_lnum (b.pos_cnum - b.pos_bol + 1)
@@ -11,35 +11,82 @@ open Typing_error
 module OperatorChecker = struct
   let check_binop ~loc op t1 t2 =
     match op with
-    | Badd | Bsub | Bmul | Bdiv | Bmod ->
-        if t1 = Tint && t2 = Tint then Tint
+    | Badd | Bsub | Bmul | Bdiv ->
+        (* there is no implicit conversion between numeric types, nor
+           between named types *)
+        if Types.is_integer t1 && Types.equal t1 t2 then t1
+        else if Types.is_float t1 && Types.equal t1 t2 then t1
+        else if op = Badd && Types.is_string t1 && Types.equal t1 t2 then t1
         else
-          errorm ~loc "operator %s requires two integers%s, got %s and %s"
+          errorm ~loc
+            "operator %s requires two integers or two float64%s, got %s and %s"
             (Utils.string_of_binop op)
             (if op = Badd then " (or two strings)" else "")
             (Types.to_string t1) (Types.to_string t2)
-    | Blt | Ble | Bgt | Bge ->
-        if t1 = Tint && t2 = Tint then Tbool
+    | Bmod | Bbitand | Bbitor | Bxor | Bandnot ->
+        if Types.is_integer t1 && Types.equal t1 t2 then t1
         else
           errorm ~loc "operator %s requires two integers, got %s and %s"
             (Utils.string_of_binop op) (Types.to_string t1) (Types.to_string t2)
+    | Bshl | Bshr ->
+        (* the count may be of any integer type, the result has the type of
+           the shifted operand *)
+        if not (Types.is_integer t1) then
+          errorm ~loc "operator %s requires an integer to shift, got %s"
+            (Utils.string_of_binop op) (Types.to_string t1);
+        if not (Types.is_integer t2) then
+          errorm ~loc "shift count must be an integer, got %s"
+            (Types.to_string t2);
+        t1
+    | Blt | Ble | Bgt | Bge ->
+        (* strings are ordered lexicographically, byte by byte *)
+        if
+          (Types.is_integer t1 || Types.is_float t1 || Types.is_string t1)
+          && Types.equal t1 t2
+        then Tbool
+        else
+          errorm ~loc
+            "operator %s requires two numbers or two strings (compared \
+             lexicographically), got %s and %s"
+            (Utils.string_of_binop op) (Types.to_string t1) (Types.to_string t2)
+    | Beq | Bne when Types.is_array t1 || Types.is_array t2 ->
+        errorm ~loc "operator %s on arrays is not supported"
+          (Utils.string_of_binop op)
+    | Beq | Bne when Types.is_struct t1 || Types.is_struct t2 ->
+        errorm ~loc "operator %s on structures is not supported"
+          (Utils.string_of_binop op)
+    | Beq | Bne
+      when (Types.is_slice t1 || Types.is_slice t2)
+           && not (Types.is_nil t1 || Types.is_nil t2) ->
+        errorm ~loc "operator %s: a slice can only be compared to nil"
+          (Utils.string_of_binop op)
+    | Beq | Bne
+      when (Types.is_map t1 || Types.is_map t2)
+           && not (Types.is_nil t1 || Types.is_nil t2) ->
+        errorm ~loc "operator %s: a map can only be compared to nil"
+          (Utils.string_of_binop op)
     | Beq | Bne ->
         if Types.equal t1 t2 && not (t1 = Tnil && t2 = Tnil) then Tbool
         else
           errorm ~loc "operator %s requires compatible types, got %s and %s"
             (Utils.string_of_binop op) (Types.to_string t1) (Types.to_string t2)
     | Band | Bor ->
-        if t1 = Tbool && t2 = Tbool then Tbool
+        if Types.is_bool t1 && Types.equal t1 t2 then t1
         else
           errorm ~loc "operator %s requires two booleans, got %s and %s"
             (Utils.string_of_binop op) (Types.to_string t1) (Types.to_string t2)
 
   let check_unop_simple ~loc op t =
     match op with
-    | Uneg when t = Tint -> Tint
-    | Uneg -> errorm ~loc "unary - requires int, got %s" (Types.to_string t)
-    | Unot when t = Tbool -> Tbool
+    | Uneg when Types.is_integer t || Types.is_float t -> t
+    | Uneg ->
+        errorm ~loc "unary - requires an integer or float64, got %s"
+          (Types.to_string t)
+    | Unot when Types.is_bool t -> t
     | Unot -> errorm ~loc "unary ! requires bool, got %s" (Types.to_string t)
+    | Ucompl when Types.is_integer t -> t
+    | Ucompl ->
+        errorm ~loc "unary ^ requires an integer, got %s" (Types.to_string t)
     | _ -> failwith "use check_address or check_deref for & and *"
 end
 
@@ -47,13 +94,15 @@ end
 module StructAccess = struct
   (** Extract struct from type, handling auto-dereference *)
   let extract_struct ~loc typ =
-    match typ with
+    match Types.underlying typ with
     | Tstruct s -> s
-    | Tptr (Tstruct s) -> s (* auto-dereference *)
+    | Tptr t when Types.is_struct t -> (
+        (* auto-dereference *)
+        match Types.underlying t with Tstruct s -> s | _ -> assert false)
     | Tnil -> errorm ~loc "cannot access field of nil (type unknown)"
-    | t ->
+    | _ ->
         errorm ~loc "cannot access field of non-structure type %s"
-          (Types.to_string t)
+          (Types.to_string typ)
 
   (** Find field in structure *)
   let find_field ~loc struct_type field_name =
@@ -64,19 +113,512 @@ module StructAccess = struct
           field_name
 end
 
+(** Compile-time processing of fmt.Printf format strings *)
+module FormatChecker = struct
+  (* narrower integers are extended to 64 bits, only uint needs %lu *)
+  let decimal (arg : expr) =
+    let uint = Types.equal (Types.underlying arg.expr_typ) Types.uint in
+    Fverb ((if uint then "%lu" else "%ld"), arg)
+
+  (* a bool is replaced by "true" or "false" when printed *)
+  let text (arg : expr) = Fverb ("%s", arg)
+
+  (* the UTF-8 encoding of a rune is string(r) *)
+  let character (arg : expr) =
+    text { expr_desc = TEconvert arg; expr_typ = Tstring }
+
+  let digits set (arg : expr) = Fdigits (set, arg)
+
+  let value (arg : expr) =
+    if Types.is_integer arg.expr_typ then decimal arg
+    else if Types.is_float arg.expr_typ then Ffloat arg
+    else text arg
+
+  let is_basic t =
+    Types.is_integer t || Types.is_float t || Types.is_string t
+    || Types.is_bool t
+
+  (* - wins over 0, and a value wider than its width is not truncated *)
+  let padded flags width piece =
+    if width = 0 then piece
+    else if List.mem '-' flags then Fpad (width, Pright, piece)
+    else if List.mem '0' flags then Fpad (width, Pzeros, piece)
+    else Fpad (width, Pleft, piece)
+
+  (* how a Go verb formats its argument, the types it accepts and how they
+     are named in errors *)
+  let verb_spec = function
+    | 'd' -> Some (decimal, Types.is_integer, "an integer")
+    | 'c' -> Some (character, Types.is_integer, "an integer")
+    | 'x' -> Some (digits "0123456789abcdef", Types.is_integer, "an integer")
+    | 'X' -> Some (digits "0123456789ABCDEF", Types.is_integer, "an integer")
+    | 'o' -> Some (digits "01234567", Types.is_integer, "an integer")
+    | 'b' -> Some (digits "01", Types.is_integer, "an integer")
+    | 's' -> Some (text, Types.is_string, "string")
+    | 't' -> Some (text, Types.is_bool, "bool")
+    | 'v' -> Some (value, is_basic, "an integer, a float64, a string or a bool")
+    | _ -> None
+
+  (* splits the format in literal runs and verbs, checking each argument;
+     arguments are numbered from 1, not counting the format itself *)
+  let pieces ~loc ~context (format : string) (args : expr list) :
+      format_piece list =
+    let buf = Buffer.create 16 in
+    let pieces = ref [] in
+    let flush () =
+      if Buffer.length buf > 0 then begin
+        pieces := Fstring (Buffer.contents buf) :: !pieces;
+        Buffer.clear buf
+      end
+    in
+    let args = ref args in
+    let index = ref 0 in
+    let n = String.length format in
+    let i = ref 0 in
+    while !i < n do
+      let c = format.[!i] in
+      if c <> '%' then Buffer.add_char buf c
+      else begin
+        let start = !i in
+        incr i;
+        (* the flags - and 0, in any order, then the width *)
+        let flags = ref [] in
+        while !i < n && (format.[!i] = '-' || format.[!i] = '0') do
+          flags := format.[!i] :: !flags;
+          incr i
+        done;
+        let width = ref 0 in
+        while !i < n && format.[!i] >= '0' && format.[!i] <= '9' do
+          width := (10 * !width) + Char.code format.[!i] - Char.code '0';
+          incr i
+        done;
+        if !i >= n then
+          errorm ~loc "%s: format ends with an incomplete verb" context;
+        match format.[!i] with
+        | '%' -> Buffer.add_char buf '%'
+        | v -> (
+            match verb_spec v with
+            | None ->
+                errorm ~loc
+                  "%s: unsupported verb %%%c at offset %d of the format"
+                  context v start
+            | Some (piece, accepts, expected) -> (
+                incr index;
+                match !args with
+                | [] ->
+                    errorm ~loc "%s: missing argument for verb %%%c" context v
+                | arg :: rest ->
+                    if not (accepts arg.expr_typ) then
+                      errorm ~loc
+                        "%s: verb %%%c expects %s, argument %d has type %s"
+                        context v expected !index
+                        (Types.to_string arg.expr_typ);
+                    flush ();
+                    pieces := padded !flags !width (piece arg) :: !pieces;
+                    args := rest))
+      end;
+      incr i
+    done;
+    flush ();
+    if !args <> [] then
+      errorm ~loc "%s: extra argument %d with no matching verb" context
+        (!index + 1);
+    List.rev !pieces
+
+  let format_string ~loc ~context (typed_args : expr list) : format_piece list
+      =
+    match typed_args with
+    | { expr_desc = TEconstant (Cstring format) | TEtyped (Cstring format) }
+      :: args ->
+        pieces ~loc ~context format args
+    | _ -> errorm ~loc "%s expects a constant format string" context
+end
+
+(** Evaluation of constant expressions *)
+module ConstEval = struct
+  (* the typed constant expressions are computed on 64 bits, where an
+     overflow is reported; the untyped integer ones exactly, see [exact] *)
+  let overflow ~loc typ =
+    errorm ~loc "constant expression overflows %s" (Types.to_string typ)
+
+  (* the values of uint64 above max_int are kept by their bits, and so are
+     negative here: they are added, compared and divided as unsigned *)
+  let unsigned typ = Types.underlying typ = Tinteger (64, false)
+
+  let add ~loc typ a b =
+    let r = Int64.add a b in
+    let overflowed =
+      if unsigned typ then Int64.unsigned_compare r a < 0
+      else
+        (* both operands have the sign that the result lacks *)
+        Int64.logand (Int64.logxor a r) (Int64.logxor b r) < 0L
+    in
+    if overflowed then overflow ~loc typ;
+    r
+
+  let sub ~loc typ a b =
+    let r = Int64.sub a b in
+    let overflowed =
+      if unsigned typ then Int64.unsigned_compare a b < 0
+      else Int64.logand (Int64.logxor a b) (Int64.logxor a r) < 0L
+    in
+    if overflowed then overflow ~loc typ;
+    r
+
+  let mul ~loc typ a b =
+    let r = Int64.mul a b in
+    let overflowed =
+      if unsigned typ then a <> 0L && Int64.unsigned_div r a <> b
+      else (a = -1L && b = Int64.min_int) || (a <> 0L && Int64.div r a <> b)
+    in
+    if overflowed then overflow ~loc typ;
+    r
+
+  let div ~loc typ a b =
+    if unsigned typ then Int64.unsigned_div a b
+    else begin
+      if a = Int64.min_int && b = -1L then overflow ~loc typ;
+      Int64.div a b
+    end
+
+  let rem typ a b =
+    if unsigned typ then Int64.unsigned_rem a b else Int64.rem a b
+
+  (* counts are not negative; a count of 64 or more only keeps 0 *)
+  let shl ~loc typ a b =
+    if a = 0L then 0L
+    else begin
+      if b >= 64L then overflow ~loc typ;
+      let n = Int64.to_int b in
+      let r = Int64.shift_left a n in
+      let back =
+        if unsigned typ then Int64.shift_right_logical r n
+        else Int64.shift_right r n
+      in
+      if back <> a then overflow ~loc typ;
+      r
+    end
+
+  (* a negative value shifted right by 64 or more is -1 *)
+  let shr typ a b =
+    if unsigned typ then
+      if b >= 64L then 0L else Int64.shift_right_logical a (Int64.to_int b)
+    else Int64.shift_right a (Int64.to_int (min b 63L))
+
+  (* ^x only keeps the bits of an unsigned type *)
+  let complement typ a =
+    match Types.underlying typ with
+    | Tinteger (bits, false) when bits < 64 ->
+        Int64.logand (Int64.lognot a) (snd (Types.integer_bounds typ))
+    | _ -> Int64.lognot a
+
+  (* the float64 nearest to the integer [n] of type [typ]; the low bit is
+     kept in the halved value, so that it is rounded as the whole one *)
+  let to_float typ n =
+    if unsigned typ && n < 0L then
+      let half = Int64.shift_right_logical n 1 in
+      2. *. Int64.to_float (Int64.logor half (Int64.logand n 1L))
+    else Int64.to_float n
+
+  (* [typ] is the type of the operands; operands are already typechecked,
+     and divisions by a zero constant are rejected before evaluation *)
+  let binop ~loc typ op c1 c2 : constant option =
+    match (op, c1, c2) with
+    | Badd, Cint a, Cint b -> Some (Cint (add ~loc typ a b))
+    | Bsub, Cint a, Cint b -> Some (Cint (sub ~loc typ a b))
+    | Bmul, Cint a, Cint b -> Some (Cint (mul ~loc typ a b))
+    | Bdiv, Cint a, Cint b when b <> 0L -> Some (Cint (div ~loc typ a b))
+    | Bmod, Cint a, Cint b when b <> 0L -> Some (Cint (rem typ a b))
+    | Bbitand, Cint a, Cint b -> Some (Cint (Int64.logand a b))
+    | Bbitor, Cint a, Cint b -> Some (Cint (Int64.logor a b))
+    | Bxor, Cint a, Cint b -> Some (Cint (Int64.logxor a b))
+    | Bandnot, Cint a, Cint b -> Some (Cint (Int64.logand a (Int64.lognot b)))
+    | Bshl, Cint a, Cint b when b >= 0L -> Some (Cint (shl ~loc typ a b))
+    | Bshr, Cint a, Cint b when b >= 0L -> Some (Cint (shr typ a b))
+    | Badd, Cfloat a, Cfloat b -> Some (Cfloat (a +. b))
+    | Bsub, Cfloat a, Cfloat b -> Some (Cfloat (a -. b))
+    | Bmul, Cfloat a, Cfloat b -> Some (Cfloat (a *. b))
+    | Bdiv, Cfloat a, Cfloat b -> Some (Cfloat (a /. b))
+    | Badd, Cstring a, Cstring b -> Some (Cstring (a ^ b))
+    | Beq, a, b -> Some (Cbool (a = b))
+    | Bne, a, b -> Some (Cbool (a <> b))
+    | (Blt | Ble | Bgt | Bge), Cint a, Cint b when unsigned typ ->
+        let c = Int64.unsigned_compare a b in
+        Some
+          (Cbool
+             (match op with
+             | Blt -> c < 0
+             | Ble -> c <= 0
+             | Bgt -> c > 0
+             | _ -> c >= 0))
+    | Blt, a, b -> Some (Cbool (a < b))
+    | Ble, a, b -> Some (Cbool (a <= b))
+    | Bgt, a, b -> Some (Cbool (a > b))
+    | Bge, a, b -> Some (Cbool (a >= b))
+    | Band, Cbool a, Cbool b -> Some (Cbool (a && b))
+    | Bor, Cbool a, Cbool b -> Some (Cbool (a || b))
+    | _ -> None
+
+  (* [typ] is the type of the result *)
+  let unop ~loc typ op c : constant option =
+    match (op, c) with
+    | Uneg, Cint a -> Some (Cint (sub ~loc typ 0L a))
+    | Ucompl, Cint a -> Some (Cint (complement typ a))
+    | Uneg, Cfloat a -> Some (Cfloat (-.a))
+    | Unot, Cbool b -> Some (Cbool (not b))
+    | _ -> None
+
+  let rec eval ~loc (e : expr) : constant option =
+    match e.expr_desc with
+    | TEconstant c | TEtyped c -> Some c
+    | TEexact _ -> None
+    | TEbinop (op, e1, e2) -> (
+        match (eval ~loc e1, eval ~loc e2) with
+        | Some c1, Some c2 -> binop ~loc e1.expr_typ op c1 c2
+        | _ -> None)
+    | TEunop (op, e1) -> (
+        match eval ~loc e1 with
+        | Some c -> unop ~loc e.expr_typ op c
+        | None -> None)
+    | _ -> None
+
+  (* a constant of a narrower integer type must be one of its values;
+     [from] is the type it has, by default [typ], that tells how its bits
+     are read *)
+  let check_bounds ~loc ?from typ c =
+    let from = Option.value from ~default:typ in
+    match (Types.underlying typ, c) with
+    | (Tint | Tinteger _), Cint n when unsigned from && n < 0L ->
+        if not (unsigned typ) then
+          errorm ~loc "constant %Lu overflows %s" n (Types.to_string typ)
+    | (Tint | Tinteger _), Cint n ->
+        let lo, hi = Types.integer_bounds typ in
+        if n < lo || n > hi then
+          errorm ~loc "constant %Ld overflows %s" n (Types.to_string typ)
+    | _ -> ()
+
+  (* the exact value of an untyped integer operand: a TEexact leaf, or an
+     expression that fits an int64, as the operations that do not are
+     folded into one *)
+  let exact ~loc (e : expr) =
+    match (e.expr_desc, eval ~loc e) with
+    | TEexact b, _ -> Some b
+    | _, Some (Cint n) -> Some (Bigint.of_int64 n)
+    | _ -> None
+
+  let exact_binop ~loc op a b =
+    let r =
+      match op with
+      | Badd -> Some (Bigint.add a b)
+      | Bsub -> Some (Bigint.sub a b)
+      | Bmul -> Some (Bigint.mul a b)
+      | Bdiv when not (Bigint.is_zero b) -> Some (Bigint.div a b)
+      | Bmod when not (Bigint.is_zero b) -> Some (Bigint.rem a b)
+      | Bbitand -> Some (Bigint.logand a b)
+      | Bbitor -> Some (Bigint.logor a b)
+      | Bxor -> Some (Bigint.logxor a b)
+      | Bandnot -> Some (Bigint.logand a (Bigint.lognot b))
+      | (Bshl | Bshr) when Bigint.is_negative b -> None
+      | Bshl when Bigint.is_zero a -> Some a
+      | Bshl -> (
+          match Bigint.to_int64 b with
+          | Some n when n <= Int64.of_int Bigint.limit ->
+              Some (Bigint.shift_left a (Int64.to_int n))
+          | _ -> errorm ~loc "constant shift overflow")
+      | Bshr ->
+          let n = Option.value (Bigint.to_int64 b) ~default:Int64.max_int in
+          let n = Int64.to_int (min n (Int64.of_int Bigint.width)) in
+          Some (Bigint.shift_right a n)
+      | _ -> None
+    in
+    match r with
+    | Some r when Bigint.bits r > Bigint.limit ->
+        errorm ~loc "constant overflow"
+    | r -> r
+
+  let exact_compare op a b =
+    let c = Bigint.compare a b in
+    match op with
+    | Beq -> Some (c = 0)
+    | Bne -> Some (c <> 0)
+    | Blt -> Some (c < 0)
+    | Ble -> Some (c <= 0)
+    | Bgt -> Some (c > 0)
+    | Bge -> Some (c >= 0)
+    | _ -> None
+
+  (* the value of type [typ] of the exact constant [b] *)
+  let of_exact ~loc typ b =
+    let n = if unsigned typ then Bigint.to_uint64 b else Bigint.to_int64 b in
+    match n with
+    | Some n ->
+        check_bounds ~loc typ (Cint n);
+        Cint n
+    | None ->
+        errorm ~loc "constant %s overflows %s" (Bigint.to_string b)
+          (Types.to_string typ)
+end
+
 (** Expression analysis utilities *)
 module ExprAnalysis = struct
   let is_lvalue (e : pexpr) : bool =
     match e.pexpr_desc with
-    | PEident _ | PEdot _ | PEunop _ -> true
+    | PEident _ | PEdot _ | PEunop (Ustar, _) | PEindex _ -> true
     | _ -> false
 
   let require_lvalue ~loc e =
     if not (is_lvalue e) then errorm ~loc "expression must be an lvalue"
 
+  (* constants are replaced by their value, so they are no lvalues *)
+  let require_variable ~loc ~action (e : pexpr) (te : expr) =
+    match (e.pexpr_desc, te.expr_desc) with
+    | PEident id, (TEconstant _ | TEtyped _ | TEexact _) ->
+        errorm ~loc "cannot %s constant %s" action id.id
+    | _ -> ()
+
   let require_type ~loc expected actual context =
     ArityChecker.check_single ~loc ~expected ~actual ~context
 
+  (* the call of a function without results is only a statement *)
+  let require_value (e : pexpr) (te : expr) =
+    match (e.pexpr_desc, te.expr_typ) with
+    | PEcall (f, _), Tmany [] ->
+        errorm ~loc:e.pexpr_loc "%s() (no value) used as value" f.id
+    | _ -> ()
+
+  (* a call may be a statement, that discards its results, unless it only
+     computes a value, as the builtins and the conversions do *)
+  let require_statement (e : pexpr) (te : expr) =
+    let unused () =
+      errorm ~loc:e.pexpr_loc "value of type %s is not used"
+        (Types.to_string te.expr_typ)
+    in
+    match (e.pexpr_desc, te.expr_desc) with
+    | ( PEcall _,
+        ( TElen _ | TEappend _ | TEnew _ | TEconvert _ | TEconstant _
+        | TEtyped _ ) ) ->
+        unused ()
+    | ( ( PEconstant _ | PErune _ | PEbinop _ | PEunop _ | PEnil | PEident _
+        | PEdot _ | PEindex _ | PEcomposite _ ),
+        _ ) ->
+        unused ()
+    | _ -> ()
+
+  let is_exact (te : expr) =
+    match te.expr_desc with TEexact _ -> true | _ -> false
+
+  (* an expression of constants only, that ConstEval evaluates *)
+  let rec is_constant (te : expr) =
+    match te.expr_desc with
+    | TEconstant _ | TEtyped _ | TEexact _ -> true
+    | TEbinop (_, e1, e2) -> is_constant e1 && is_constant e2
+    | TEunop ((Uneg | Unot | Ucompl), e) -> is_constant e
+    | _ -> false
+
+  (* a constant is untyped when none of its operands is typed, the count of
+     a shift apart; a comparison of constants is always untyped *)
+  let rec untyped (te : expr) =
+    match te.expr_desc with
+    | TEconstant _ | TEexact _ -> true
+    | TEbinop ((Beq | Bne | Blt | Ble | Bgt | Bge), e1, e2) ->
+        is_constant e1 && is_constant e2
+    | TEbinop ((Bshl | Bshr), e1, e2) -> untyped e1 && is_constant e2
+    | TEbinop (_, e1, e2) -> untyped e1 && untyped e2
+    | TEunop ((Uneg | Unot | Ucompl), e) -> untyped e
+    | _ -> false
+
+  (* the value of the untyped constant te as one of type typ: an integer
+     constant is a value of any integer type that holds it, and of float64,
+     and a constant of a basic type one of any type named after it *)
+  let represent ~loc typ (te : expr) =
+    let basic =
+      match Types.underlying typ with
+      | (Tfloat | Tstring | Tbool) as t -> t = te.expr_typ
+      | _ -> false
+    in
+    match (te.expr_desc, ConstEval.eval ~loc te) with
+    | TEexact b, _ when Types.is_float typ -> Some (Cfloat (Bigint.to_float b))
+    | TEexact b, _ when Types.is_integer typ ->
+        Some (ConstEval.of_exact ~loc typ b)
+    | _, Some (Cint n) when Types.is_float typ ->
+        Some (Cfloat (ConstEval.to_float te.expr_typ n))
+    | _, Some (Cint _ as c) when Types.is_integer typ ->
+        ConstEval.check_bounds ~loc ~from:te.expr_typ typ c;
+        Some c
+    | _, Some c when basic -> Some c
+    | _ -> None
+
+  (* as in Go, only an untyped constant is converted, and it is then typed;
+     a typed one keeps its type *)
+  let convert ~loc typ (te : expr) : expr =
+    if untyped te && (is_exact te || not (Types.equal typ te.expr_typ)) then
+      match represent ~loc typ te with
+      | Some c -> { expr_desc = TEtyped c; expr_typ = typ }
+      | None -> te
+    else te
+
+  (* an untyped integer constant beyond int64 is only an operand of other
+     constants, or converted: as a value, it overflows its default type *)
+  let require_representable ~loc (te : expr) =
+    match te.expr_desc with
+    | TEexact b ->
+        errorm ~loc "constant %s overflows %s" (Bigint.to_string b)
+          (Types.to_string te.expr_typ)
+    | _ -> ()
+
+  let convert_all ~loc types (tel : expr list) =
+    if List.length types = List.length tel then
+      List.map2 (convert ~loc) types tel
+    else tel
+
+  (* te used where a value of type typ is expected *)
+  let value ~loc typ te context =
+    let te = convert ~loc typ te in
+    require_type ~loc typ te.expr_typ context;
+    te
+
+  (* an untyped operand takes the type of the other one; of two untyped
+     ones, the one whose kind comes first in int, rune and float64 takes the
+     kind of the other, as 'a' + 1 is a rune, and is still untyped *)
+  let unify ~loc (te1 : expr) (te2 : expr) =
+    let kind (te : expr) =
+      if Types.is_float te.expr_typ then 2
+      else if te.expr_typ = Types.rune then 1
+      else 0
+    in
+    let retype typ te =
+      match represent ~loc typ te with
+      | Some c -> { expr_desc = TEconstant c; expr_typ = typ }
+      | None -> te
+    in
+    match (untyped te1, untyped te2) with
+    | true, true when kind te1 < kind te2 -> (retype te2.expr_typ te1, te2)
+    | true, true when kind te1 > kind te2 -> (te1, retype te1.expr_typ te2)
+    | true, false -> (convert ~loc te2.expr_typ te1, te2)
+    | false, true -> (te1, convert ~loc te1.expr_typ te2)
+    | _ -> (te1, te2)
+
+  (* the elements of a map are moved when it grows: m[k] = v replaces one,
+     but their address is never taken, and so their fields and elements
+     cannot be assigned *)
+  let rec in_map (te : expr) =
+    match te.expr_desc with
+    | TEindex (e, _) when Types.is_map e.expr_typ -> true
+    | TEindex (e, _) when Types.is_array e.expr_typ -> in_map e
+    | TEdot (e, _) when Types.is_struct e.expr_typ -> in_map e
+    | _ -> false
+
+  let require_addressable ~loc ~assign (te : expr) =
+    match te.expr_desc with
+    | TEindex (e, _) when Types.is_map e.expr_typ && assign -> ()
+    | TEindex (e, _) when Types.is_map e.expr_typ ->
+        errorm ~loc "cannot take the address of a map element"
+    | _ when in_map te ->
+        errorm ~loc "cannot assign to a field or element of a map element"
+    | TEargs when assign -> errorm ~loc "cannot assign to os.Args"
+    | TEargs -> errorm ~loc "cannot take the address of os.Args"
+    | _ -> ()
+
   (** Mark variables as having their address taken *)
   let rec mark_address_taken = function
     | TEident v -> v.v_addr <- true
@@ -90,21 +632,114 @@ module ExprTypecheck = struct
 
   let constant (c : constant) : expr =
     let typ =
-      match c with Cbool _ -> Tbool | Cint _ -> Tint | Cstring _ -> Tstring
+      match c with
+      | Cbool _ -> Tbool
+      | Cint _ -> Tint
+      | Cfloat _ -> Tfloat
+      | Cstring _ -> Tstring
     in
     { expr_desc = TEconstant c; expr_typ = typ }
 
+  (* a constant of its default type, that is no longer untyped *)
+  let typed (c : constant) : expr =
+    { (constant c) with expr_desc = TEtyped c }
+
+  (* the length of an array type is a constant expression *)
+  let array_length (typecheck_rec : pexpr -> expr) (e : pexpr) : int =
+    let loc = e.pexpr_loc in
+    match ConstEval.eval ~loc (typecheck_rec e) with
+    | Some (Cint n) when n >= 0L -> Int64.to_int n
+    | Some (Cint n) -> errorm ~loc "invalid array length %Ld" n
+    | _ -> errorm ~loc "array length must be a constant integer"
+
+  let typ typecheck_rec ctx pt =
+    Types.from_ptyp ~length:(array_length typecheck_rec) ctx.structs pt
+
+  let check_division ~loc op (divisor : expr) =
+    match (op, ConstEval.eval ~loc divisor) with
+    | (Bdiv | Bmod), Some (Cint 0L) ->
+        errorm ~loc "invalid operation: division by zero"
+    | Bdiv, Some (Cfloat f) when f = 0.0 ->
+        errorm ~loc "invalid operation: division by zero"
+    | _ -> ()
+
+  let check_shift ~loc op (count : expr) =
+    match (op, ConstEval.eval ~loc count) with
+    | (Bshl | Bshr), Some (Cint n) when n < 0L ->
+        errorm ~loc "invalid operation: negative shift count %Ld" n
+    | _ -> ()
+
+  (* the count of a shift keeps its own type, any integer one *)
+  let operands ~loc op te1 te2 =
+    match op with
+    | Bshl | Bshr -> (te1, te2)
+    | _ -> ExprAnalysis.unify ~loc te1 te2
+
+  (* a constant expression is evaluated only to report overflows *)
+  let check_constant ~loc (te : expr) =
+    match ConstEval.eval ~loc te with
+    | Some c -> ConstEval.check_bounds ~loc te.expr_typ c
+    | None -> ()
+
+  (* the untyped integer constant te of value b, kept exactly when it
+     does not fit in an int64 *)
+  let exact_leaf (te : expr) b =
+    match Bigint.to_int64 b with
+    | Some n -> { te with expr_desc = TEconstant (Cint n) }
+    | None -> { te with expr_desc = TEexact b }
+
+  let is_untyped_integer (te : expr) =
+    ExprAnalysis.untyped te && Types.is_integer te.expr_typ
+
+  (* the operation te on untyped integer constants, folded when one of its
+     operands or its result does not fit in an int64 *)
+  let fold_exact ~loc op te1 te2 (te : expr) =
+    match (ConstEval.exact ~loc te1, ConstEval.exact ~loc te2) with
+    | Some a, Some b when is_untyped_integer te1 -> (
+        let folded = ExprAnalysis.(is_exact te1 || is_exact te2) in
+        match ConstEval.exact_compare op a b with
+        | Some r when folded ->
+            Some { te with expr_desc = TEconstant (Cbool r) }
+        | Some _ -> None
+        | None -> (
+            match ConstEval.exact_binop ~loc op a b with
+            | Some r when folded || Bigint.to_int64 r = None ->
+                Some (exact_leaf te r)
+            | _ -> None))
+    | _ -> None
+
   let binop (typecheck_rec : pexpr -> expr) op e1 e2 loc : expr =
-    let te1 = typecheck_rec e1 in
-    let te2 = typecheck_rec e2 in
+    let te1, te2 = operands ~loc op (typecheck_rec e1) (typecheck_rec e2) in
     let result_type =
       OperatorChecker.check_binop ~loc op te1.expr_typ te2.expr_typ
     in
-    { expr_desc = TEbinop (op, te1, te2); expr_typ = result_type }
+    check_division ~loc:e2.pexpr_loc op te2;
+    check_shift ~loc:e2.pexpr_loc op te2;
+    let te = { expr_desc = TEbinop (op, te1, te2); expr_typ = result_type } in
+    match fold_exact ~loc op te1 te2 te with
+    | Some te -> te
+    | None -> (
+        ExprAnalysis.require_representable ~loc:e1.pexpr_loc te1;
+        ExprAnalysis.require_representable ~loc:e2.pexpr_loc te2;
+        check_constant ~loc te;
+        (* two constant strings are joined here, so that only the result is
+           interned and nothing is allocated at run time *)
+        match (te1.expr_desc, te2.expr_desc) with
+        | ( (TEconstant (Cstring a) | TEtyped (Cstring a)),
+            (TEconstant (Cstring b) | TEtyped (Cstring b)) ) ->
+            let c = Cstring (a ^ b) in
+            if ExprAnalysis.untyped te then { te with expr_desc = TEconstant c }
+            else { te with expr_desc = TEtyped c }
+        | _ -> te)
 
   let unop_address ~loc te t e =
-    (* Check lvalue only for address-of operator *)
-    ExprAnalysis.require_lvalue ~loc e;
+    (* Check lvalue only for address-of operator; &T{...} points to a new
+       value *)
+    (match e.pexpr_desc with
+    | PEcomposite _ -> ()
+    | _ -> ExprAnalysis.require_lvalue ~loc e);
+    ExprAnalysis.require_variable ~loc ~action:"take the address of" e te;
+    ExprAnalysis.require_addressable ~loc ~assign:false te;
     if t = Tnil then errorm ~loc "cannot take address of nil";
     ExprAnalysis.mark_address_taken te.expr_desc;
     Tptr t
@@ -122,11 +757,25 @@ module ExprTypecheck = struct
     let t = te.expr_typ in
     let result_type =
       match op with
-      | Uneg | Unot -> OperatorChecker.check_unop_simple ~loc op t
+      | Uneg | Unot | Ucompl -> OperatorChecker.check_unop_simple ~loc op t
       | Uamp -> unop_address ~loc te t e (* lvalue check is inside *)
       | Ustar -> unop_deref ~loc t
     in
-    { expr_desc = TEunop (op, te); expr_typ = result_type }
+    let result = { expr_desc = TEunop (op, te); expr_typ = result_type } in
+    (* as for binop, on an untyped integer constant *)
+    let exact =
+      match (op, ConstEval.exact ~loc te) with
+      | Uneg, Some a when is_untyped_integer te -> Some (Bigint.neg a)
+      | Ucompl, Some a when is_untyped_integer te -> Some (Bigint.lognot a)
+      | _ -> None
+    in
+    match exact with
+    | Some r when ExprAnalysis.is_exact te || Bigint.to_int64 r = None ->
+        exact_leaf result r
+    | _ ->
+        ExprAnalysis.require_representable ~loc:e.pexpr_loc te;
+        check_constant ~loc result;
+        result
 
   let nil () : expr = { expr_desc = TEnil; expr_typ = Tnil }
 
@@ -146,7 +795,36 @@ module ExprTypecheck = struct
     fmt_print_used := true;
     List.map typecheck_rec pexpr_list
 
+  (* fmt.Print adds a space between two operands when neither is a string,
+     however its type is named: fmt.Print(1, 2, "x", 3) prints 1 2x3 *)
+  let fmt_print_spaces typed_args =
+    let str s = constant (Cstring s) in
+    let rec interleave = function
+      | e1 :: (e2 :: _ as el)
+        when not (Types.is_string e1.expr_typ || Types.is_string e2.expr_typ)
+        ->
+          e1 :: str " " :: interleave el
+      | e :: el -> e :: interleave el
+      | [] -> []
+    in
+    interleave typed_args
+
+  (* fmt.Println(e1,...,en) => fmt.Print(e1, " ", ..., " ", en, "\n") *)
+  let fmt_println typed_args =
+    let str s = constant (Cstring s) in
+    let rec interleave = function
+      | [] -> [ str "\n" ]
+      | [ e ] -> [ e; str "\n" ]
+      | e :: el -> e :: str " " :: interleave el
+    in
+    interleave typed_args
+
   let regular_call ~loc func_def typed_args =
+    let typed_args =
+      ExprAnalysis.convert_all ~loc
+        (List.map (fun v -> v.v_typ) func_def.fn_params)
+        typed_args
+    in
     let arg_types = List.map (fun te -> te.expr_typ) typed_args in
     let actual_types =
       ArityChecker.unpack_and_check ~loc
@@ -160,19 +838,291 @@ module ExprTypecheck = struct
       ~context:("function " ^ func_def.fn_name ^ " argument");
     typed_args
 
-  let call ctx typecheck_rec ident pexpr_list loc fmt_print_used : expr =
+  (* the arguments of f(x1 T1, ..., xs ...T) that follow those of the
+     other parameters are gathered in a slice []T, nil if there are none,
+     unless a slice []T is passed as s... *)
+  let is_spread (e : pexpr) =
+    match e.pexpr_desc with PEspread _ -> true | _ -> false
+
+  let variadic_call typecheck_rec func_def pexpr_list loc : expr =
+    let name = func_def.fn_name in
+    if not func_def.fn_variadic then
+      errorm ~loc "cannot use ... in call to non-variadic function %s" name;
+    let rec split n = function
+      | args when n = 0 -> ([], args)
+      | e :: _ when is_spread e ->
+          errorm ~loc:e.pexpr_loc "not enough arguments in call to %s" name
+      | e :: args ->
+          let fixed, rest = split (n - 1) args in
+          (e :: fixed, rest)
+      | [] -> errorm ~loc "not enough arguments in call to %s" name
+    in
+    let fixed, rest = split (List.length func_def.fn_params - 1) pexpr_list in
+    let slice = (List.nth func_def.fn_params (List.length fixed)).v_typ in
+    let t =
+      match Types.underlying slice with Tslice t -> t | _ -> assert false
+    in
+    let variadic =
+      match rest with
+      | [ { pexpr_desc = PEspread e } ] -> (
+          match typecheck_rec e with
+          | te when Types.is_slice te.expr_typ -> te
+          | te ->
+              errorm ~loc:e.pexpr_loc "cannot use ... with %s, not a slice"
+                (Types.to_string te.expr_typ))
+      | rest when List.exists is_spread rest ->
+          errorm ~loc
+            "too many arguments in call to %s: a slice s... is the only \
+             variadic argument"
+            name
+      | [] -> { expr_desc = TEnil; expr_typ = slice }
+      | rest ->
+          let element (e : pexpr) =
+            ExprAnalysis.value ~loc:e.pexpr_loc t (typecheck_rec e)
+              ("function " ^ name ^ " argument")
+          in
+          { expr_desc = TEarray (List.map element rest); expr_typ = slice }
+    in
+    let typed_args = List.map typecheck_rec fixed @ [ variadic ] in
+    {
+      expr_desc = TEcall (func_def, regular_call ~loc func_def typed_args);
+      expr_typ = ResultType.make func_def.fn_typ;
+    }
+
+  (* the effects that an expression can have come from the functions it
+     calls *)
+  let rec has_call (e : expr) =
+    match e.expr_desc with
+    | TEcall _ | TEappend _ | TEsprintf _ -> true
+    | TEunop (_, e) | TEdot (e, _) | TElen e | TEconvert e -> has_call e
+    | TEbinop (_, e1, e2) | TEindex (e1, e2) -> has_call e1 || has_call e2
+    | TEarray el -> List.exists has_call el
+    | TEstruct fl -> List.exists (fun (_, e) -> has_call e) fl
+    | TEmap kvl -> List.exists (fun (k, v) -> has_call k || has_call v) kvl
+    | _ -> false
+
+  (* the length of a constant string, or of an array that can be left
+     unevaluated, is a constant; the one of a string is its number of bytes *)
+  let len typecheck_rec pexpr_list loc : expr =
+    let shape (te : expr) =
+      match Types.underlying te.expr_typ with
+      | Tptr t -> Tptr (Types.underlying t)
+      | t -> t
+    in
+    match List.map typecheck_rec pexpr_list with
+    | [ { expr_desc = TEconstant (Cstring s) | TEtyped (Cstring s) } ] ->
+        typed (Cint (Int64.of_int (String.length s)))
+    | [ te ] -> (
+        match shape te with
+        | (Tarray (_, n) | Tptr (Tarray (_, n))) when not (has_call te) ->
+            typed (Cint (Int64.of_int n))
+        | Tstring | Tslice _ | Tmap _ | Tarray _ | Tptr (Tarray _) ->
+            { expr_desc = TElen te; expr_typ = Tint }
+        | _ ->
+            errorm ~loc "invalid argument for len: %s"
+              (Types.to_string te.expr_typ))
+    | _ -> errorm ~loc "len expects exactly one argument"
+
+  (* the UTF-8 encoding of a code point, U+FFFD for an invalid one *)
+  let utf_8 n =
+    let b = Buffer.create 4 in
+    let valid = Int64.compare n 0x10FFFFL <= 0 && Int64.compare n 0L >= 0 in
+    let n = Int64.to_int n in
+    Buffer.add_utf_8_uchar b
+      (if valid && Uchar.is_valid n then Uchar.of_int n else Uchar.rep);
+    Buffer.contents b
+
+  (* T(e) between numeric types, from an integer to a string (its UTF-8
+     encoding) or between types with the same underlying type. As in Go, a
+     constant is converted when it is checked, and must then be exactly
+     representable; a float64 value is truncated toward zero when converted
+     to an integer type *)
+  let conversion ~loc typecheck_rec t pexpr_list : expr =
+    let te =
+      match List.map typecheck_rec pexpr_list with
+      | [ te ] -> te
+      | _ ->
+          errorm ~loc "conversion to %s expects exactly one argument"
+            (Types.to_string t)
+    in
+    let s = te.expr_typ in
+    let converted () = { expr_desc = TEconvert te; expr_typ = t } in
+    let folded ?(from = s) c =
+      ConstEval.check_bounds ~loc ~from t c;
+      { expr_desc = TEtyped c; expr_typ = t }
+    in
+    let us = Types.underlying s and ut = Types.underlying t in
+    match (ConstEval.eval ~loc te, us, ut) with
+    | _, _, (Tint | Tinteger _ | Tfloat) when ExprAnalysis.is_exact te ->
+        ExprAnalysis.convert ~loc t te
+    | _ when ExprAnalysis.is_exact te ->
+        ExprAnalysis.require_representable ~loc te;
+        converted ()
+    | Some c, _, _ when Types.equal us ut ->
+        { expr_desc = TEtyped c; expr_typ = t }
+    | _ when Types.equal us ut && s <> Tnil -> { te with expr_typ = t }
+    | Some (Cint n), _, (Tint | Tinteger _) -> folded (Cint n)
+    | Some (Cint n), _, Tfloat -> folded (Cfloat (ConstEval.to_float s n))
+    | Some (Cint n), _, Tstring -> folded (Cstring (utf_8 n))
+    | Some (Cfloat f), _, (Tint | Tinteger _) ->
+        (* 2^63 is the first float64 above max_int, and 2^64 the first one
+           above the largest uint64, whose bits are then those of an int64
+           2^64 below *)
+        let top = 9.2233720368547758e18 in
+        let limit = if ConstEval.unsigned t then 2. *. top else top in
+        if not (Float.is_integer f) then
+          errorm ~loc "constant %g truncated to integer" f;
+        if f < -.top || f >= limit then
+          errorm ~loc "constant %g overflows %s" f (Types.to_string t);
+        let n =
+          if f >= top then Int64.add (Int64.of_float (f -. top)) Int64.min_int
+          else Int64.of_float f
+        in
+        folded ~from:(if f < 0. then Tint else t) (Cint n)
+    | _, (Tint | Tinteger _ | Tfloat), (Tint | Tinteger _ | Tfloat)
+    | _, (Tint | Tinteger _), Tstring ->
+        converted ()
+    | _ ->
+        errorm ~loc "cannot convert %s to type %s" (Types.to_string s)
+          (Types.to_string t)
+
+  (* append(s, e1, ..., en) is the slice s followed by e1, ..., en *)
+  let append typecheck_rec pexpr_list loc : expr =
+    match List.map typecheck_rec pexpr_list with
+    | [] -> errorm ~loc "not enough arguments for append"
+    | ts :: tel when Types.is_slice ts.expr_typ ->
+        let t =
+          match Types.underlying ts.expr_typ with
+          | Tslice t -> t
+          | _ -> assert false
+        in
+        let tel =
+          List.map2
+            (fun (e : pexpr) te ->
+              ExprAnalysis.value ~loc:e.pexpr_loc t te "append")
+            (List.tl pexpr_list) tel
+        in
+        { expr_desc = TEappend (ts, tel); expr_typ = ts.expr_typ }
+    | te :: _ ->
+        errorm ~loc "first argument to append must be a slice, got %s"
+          (Types.to_string te.expr_typ)
+
+  (* delete(m, k) removes the key k from m, if it is there *)
+  let delete typecheck_rec pexpr_list loc : expr =
+    match List.map typecheck_rec pexpr_list with
+    | [ tm; tk ] when Types.is_map tm.expr_typ ->
+        let k =
+          match Types.underlying tm.expr_typ with
+          | Tmap (k, _) -> k
+          | _ -> assert false
+        in
+        let tk =
+          ExprAnalysis.value ~loc:(List.nth pexpr_list 1).pexpr_loc k tk
+            "delete"
+        in
+        { expr_desc = TEdelete (tm, tk); expr_typ = ResultType.empty }
+    | [ te; _ ] ->
+        errorm ~loc "first argument to delete must be a map, got %s"
+          (Types.to_string te.expr_typ)
+    | _ -> errorm ~loc "delete expects exactly two arguments"
+
+  (* panic(s) stops the program after printing the message s *)
+  let panic typecheck_rec pexpr_list loc : expr =
+    match (pexpr_list, List.map typecheck_rec pexpr_list) with
+    | [ e ], [ te ] ->
+        let te = ExprAnalysis.value ~loc:e.pexpr_loc Tstring te "panic" in
+        { expr_desc = TEpanic te; expr_typ = ResultType.empty }
+    | _ -> errorm ~loc "panic expects exactly one argument"
+
+  (* set when the file being typed refers to os, reset for each file *)
+  let os_used = ref false
+
+  (* os.Exit(code) ends the program at once, without running the deferred
+     calls *)
+  let os_exit typecheck_rec pexpr_list loc : expr =
+    os_used := true;
+    match (pexpr_list, List.map typecheck_rec pexpr_list) with
+    | [ e ], [ te ] ->
+        let te =
+          ExprAnalysis.value ~loc:e.pexpr_loc Tint te Constants.os_exit
+        in
+        { expr_desc = TEexit te; expr_typ = ResultType.empty }
+    | _ -> errorm ~loc "os.Exit expects exactly one argument"
+
+  (* os.Args, the program name followed by its arguments *)
+  let os_member field_ident : expr =
+    if field_ident.id <> Constants.os_args then
+      errorm ~loc:field_ident.loc "undefined: os.%s" field_ident.id;
+    os_used := true;
+    { expr_desc = TEargs; expr_typ = Tslice Tstring }
+
+  (* the argument of a conversion is typed by [typecheck_operand], as an
+     operand of a constant *)
+  let call ctx typecheck_rec typecheck_operand ident pexpr_list loc
+      fmt_print_used : expr =
     if ident.id = Constants.new_keyword then new_expr ctx pexpr_list ident.loc
+    else if ident.id = Constants.len_builtin then
+      len typecheck_rec pexpr_list ident.loc
+    else if ident.id = Constants.append_builtin then
+      append typecheck_rec pexpr_list ident.loc
+    else if ident.id = Constants.delete_builtin then
+      delete typecheck_rec pexpr_list ident.loc
+    else if ident.id = Constants.panic_builtin then
+      panic typecheck_rec pexpr_list ident.loc
     else
       match Hashtbl.find_opt ctx.funcs ident.id with
-      | None -> errorm ~loc:ident.loc "undefined function: %s" ident.id
+      | None -> (
+          let declared =
+            match Hashtbl.find_opt ctx.structs ident.id with
+            | Some s -> Some (Tstruct s)
+            | None -> Hashtbl.find_opt Types.named ident.id
+          in
+          match (Types.builtin_of_string ident.id, declared) with
+          | Some t, _ | None, Some t ->
+              conversion ~loc typecheck_operand t pexpr_list
+          | None, None ->
+              errorm ~loc:ident.loc "undefined function: %s" ident.id)
+      | Some _ when ident.id = Constants.os_exit ->
+          os_exit typecheck_rec pexpr_list ident.loc
+      | Some func_def
+        when func_def.fn_variadic || List.exists is_spread pexpr_list ->
+          variadic_call typecheck_rec func_def pexpr_list ident.loc
       | Some func_def ->
           let typed_args = List.map typecheck_rec pexpr_list in
           if ident.id = Constants.fmt_print then
             {
               expr_desc =
-                TEprint (fmt_print typecheck_rec pexpr_list fmt_print_used);
+                TEprint
+                  (fmt_print_spaces
+                     (fmt_print typecheck_rec pexpr_list fmt_print_used));
+              expr_typ = ResultType.empty;
+            }
+          else if ident.id = Constants.fmt_println then
+            {
+              expr_desc =
+                TEprint
+                  (fmt_println
+                     (fmt_print typecheck_rec pexpr_list fmt_print_used));
               expr_typ = ResultType.empty;
             }
+          else if ident.id = Constants.fmt_printf then
+            {
+              expr_desc =
+                TEprintf
+                  (FormatChecker.format_string ~loc:ident.loc
+                     ~context:ident.id
+                     (fmt_print typecheck_rec pexpr_list fmt_print_used));
+              expr_typ = ResultType.empty;
+            }
+          else if ident.id = Constants.fmt_sprintf then
+            {
+              expr_desc =
+                TEsprintf
+                  (FormatChecker.format_string ~loc:ident.loc
+                     ~context:ident.id
+                     (fmt_print typecheck_rec pexpr_list fmt_print_used));
+              expr_typ = Tstring;
+            }
           else
             let final_args = regular_call ~loc:ident.loc func_def typed_args in
             {
@@ -180,29 +1130,181 @@ module ExprTypecheck = struct
               expr_typ = ResultType.make func_def.fn_typ;
             }
 
-  let ident ctx ident : expr =
-    let v = VarEnv.find_or_error ctx.vars ident.id ident.loc in
-    VarEnv.check_not_blank v ident.loc;
-    v.v_used <- true;
-    { expr_desc = TEident v; expr_typ = v.v_typ }
+  (* a variable that is only assigned is not used *)
+  let ident ?(use = true) ctx ident : expr =
+    if Constants.is_blank ident.id then
+      errorm ~loc:ident.loc "cannot use _ as value";
+    match (VarEnv.find_global ctx.vars ident.id, ctx.iota) with
+    | None, Some iota when ident.id = Constants.iota ->
+        constant (Cint (Int64.of_int iota))
+    | _ -> (
+        let v = VarEnv.find_or_error ctx.vars ident.id ident.loc in
+        if use then v.v_used <- true;
+        match v.v_const with
+        | Some d -> { expr_desc = d; expr_typ = v.v_typ }
+        | None -> { expr_desc = TEident v; expr_typ = v.v_typ })
+
+  (* os is a package where it is imported and not hidden by a variable *)
+  let dot ctx typecheck_rec base_expr field_ident : expr =
+    match base_expr.pexpr_desc with
+    | PEident { id; _ }
+      when id = Constants.os_package
+           && Hashtbl.mem ctx.funcs Constants.os_exit
+           && Option.is_none (VarEnv.find_global ctx.vars id) ->
+        os_member field_ident
+    | _ ->
+      let tbase_expr = typecheck_rec base_expr in
+      let struct_type =
+        StructAccess.extract_struct ~loc:base_expr.pexpr_loc tbase_expr.expr_typ
+      in
+      let field =
+        StructAccess.find_field ~loc:field_ident.loc struct_type field_ident.id
+      in
+      { expr_desc = TEdot (tbase_expr, field); expr_typ = field.f_typ }
 
-  let dot typecheck_rec base_expr field_ident : expr =
-    let tbase_expr = typecheck_rec base_expr in
-    let struct_type =
-      StructAccess.extract_struct ~loc:base_expr.pexpr_loc tbase_expr.expr_typ
+  (* a pointer to an array is indexed like the array itself; a constant
+     index is checked against the length; a map is indexed by its keys *)
+  let index typecheck_rec base_expr index_expr loc : expr =
+    let tbase = typecheck_rec base_expr in
+    let tindex = typecheck_rec index_expr in
+    let require_int () =
+      if not (Types.is_integer tindex.expr_typ) then
+        errorm ~loc:index_expr.pexpr_loc "invalid index of type %s"
+          (Types.to_string tindex.expr_typ)
     in
-    let field =
-      StructAccess.find_field ~loc:field_ident.loc struct_type field_ident.id
+    let tbase =
+      match Types.underlying tbase.expr_typ with
+      | Tptr t when Types.is_array t ->
+          { expr_desc = TEunop (Ustar, tbase); expr_typ = t }
+      | _ -> tbase
     in
-    { expr_desc = TEdot (tbase_expr, field); expr_typ = field.f_typ }
+    match Types.underlying tbase.expr_typ with
+    | Tarray (t, n) ->
+        require_int ();
+        (match ConstEval.eval ~loc tindex with
+        | Some (Cint i) when i < 0L || i >= Int64.of_int n ->
+            errorm ~loc:index_expr.pexpr_loc
+              "invalid index %Ld (out of bounds for %d-element array)" i n
+        | _ -> ());
+        { expr_desc = TEindex (tbase, tindex); expr_typ = t }
+    | Tslice t ->
+        require_int ();
+        (match ConstEval.eval ~loc tindex with
+        | Some (Cint i) when i < 0L ->
+            errorm ~loc:index_expr.pexpr_loc
+              "invalid index %Ld (index must be non-negative)" i
+        | _ -> ());
+        { expr_desc = TEindex (tbase, tindex); expr_typ = t }
+    | Tmap (k, v) ->
+        let tindex =
+          ExprAnalysis.value ~loc:index_expr.pexpr_loc k tindex "map index"
+        in
+        { expr_desc = TEindex (tbase, tindex); expr_typ = v }
+    | _ ->
+        errorm ~loc "cannot index expression of type %s"
+          (Types.to_string tbase.expr_typ)
 
-  let assign typecheck_rec lhs_list rhs_list loc : expr =
-    List.iter (ExprAnalysis.require_lvalue ~loc) lhs_list;
+  (* in {e1, ..., en}, an element of a literal, the type is the one of the
+     elements of the enclosing literal *)
+  let rec composite typecheck_rec typ elements loc : expr =
+    let element context t (e : pexpr) =
+      match e.pexpr_desc with
+      | PEcomposite (None, el) -> composite typecheck_rec t el e.pexpr_loc
+      | _ -> ExprAnalysis.value ~loc:e.pexpr_loc t (typecheck_rec e) context
+    in
+    (* only the elements of a struct or map literal can be keyed *)
+    let unkeyed context =
+      List.map
+        (function
+          | None, e -> e
+          | Some (k : pexpr), _ ->
+              errorm ~loc:k.pexpr_loc "unexpected key in %s" context)
+        elements
+    in
+    match Types.underlying typ with
+    | Tarray (t, n) ->
+        let elements = unkeyed "array literal" in
+        if List.length elements > n then
+          errorm ~loc "array index %d out of bounds [0:%d]" n n;
+        {
+          expr_desc = TEarray (List.map (element "array literal" t) elements);
+          expr_typ = typ;
+        }
+    | Tslice t ->
+        let elements = unkeyed "slice literal" in
+        {
+          expr_desc = TEarray (List.map (element "slice literal" t) elements);
+          expr_typ = typ;
+        }
+    | Tstruct s ->
+        {
+          expr_desc = TEstruct (fields typecheck_rec s elements loc);
+          expr_typ = typ;
+        }
+    | Tmap (tk, tv) ->
+        (* the same constant key cannot be given twice *)
+        let seen = Hashtbl.create 8 in
+        let entry = function
+          | None, (e : pexpr) ->
+              errorm ~loc:e.pexpr_loc "missing key in map literal"
+          | Some k, v ->
+              let te = element "map literal" tk k in
+              (match ConstEval.eval ~loc:k.pexpr_loc te with
+              | Some c when Hashtbl.mem seen c ->
+                  errorm ~loc:k.pexpr_loc "duplicate key in map literal"
+              | Some c -> Hashtbl.add seen c ()
+              | None -> ());
+              (te, element "map literal" tv v)
+        in
+        { expr_desc = TEmap (List.map entry elements); expr_typ = typ }
+    | _ ->
+        errorm ~loc "invalid composite literal type %s" (Types.to_string typ)
+
+  (* either every field is given a value, in order, or the elements are
+     keyed by the names of the fields they initialize *)
+  and fields typecheck_rec s elements loc =
+    let field f (e : pexpr) =
+      let te = typecheck_rec e in
+      (f, ExprAnalysis.value ~loc:e.pexpr_loc f.f_typ te "struct literal")
+    in
+    if List.for_all (fun (key, _) -> key = None) elements && elements <> []
+    then (
+      let n = List.length s.s_list in
+      if List.length elements < n then
+        errorm ~loc "too few values in struct literal of type %s" s.s_name;
+      if List.length elements > n then
+        errorm ~loc "too many values in struct literal of type %s" s.s_name;
+      List.map2 (fun f (_, e) -> field f e) s.s_list elements)
+    else
+      let seen = Hashtbl.create 8 in
+      List.map
+        (function
+          | None, (e : pexpr) ->
+              errorm ~loc:e.pexpr_loc
+                "mixture of field:value and value elements in struct literal"
+          | Some { pexpr_desc = PEident id }, e ->
+              let f = StructAccess.find_field ~loc:id.loc s id.id in
+              if Hashtbl.mem seen id.id then
+                errorm ~loc:id.loc "duplicate field name %s in struct literal"
+                  id.id;
+              Hashtbl.add seen id.id ();
+              field f e
+          | Some k, _ ->
+              errorm ~loc:k.pexpr_loc "invalid field name in struct literal")
+        elements
 
-    let t_lhs_list = List.map typecheck_rec lhs_list in
-    let t_rhs_list = List.map typecheck_rec rhs_list in
+  (* in v, ok = m[k], the second value tells whether k is in m *)
+  let values typecheck_rec count rhs_list =
+    match List.map typecheck_rec rhs_list with
+    | [ ({ expr_desc = TEindex (m, _) } as te) ]
+      when count = 2 && Types.is_map m.expr_typ ->
+        [ { te with expr_typ = Tmany [ te.expr_typ; Tbool ] } ]
+    | tel -> tel
 
-    let lhs_types = List.map (fun l -> l.expr_typ) t_lhs_list in
+  let assign ctx typecheck_rec lhs_list rhs_list loc : expr =
+    List.iter (ExprAnalysis.require_lvalue ~loc) lhs_list;
+
+    let t_rhs_list = values typecheck_rec (List.length lhs_list) rhs_list in
     let rhs_types = List.map (fun r -> r.expr_typ) t_rhs_list in
 
     let unpacked_rhs_types =
@@ -210,6 +1312,33 @@ module ExprTypecheck = struct
         ~actual_types:rhs_types ~context:"assignment"
     in
 
+    (* _ takes the type of the value it discards *)
+    let typecheck_lhs (lhs : pexpr) rhs_type =
+      match lhs.pexpr_desc with
+      | PEident id when Constants.is_blank id.id ->
+          if Types.is_nil rhs_type then
+            errorm ~loc "use of untyped nil in assignment";
+          let v = new_var id.id id.loc rhs_type in
+          { expr_desc = TEident v; expr_typ = rhs_type }
+      | _ ->
+          let te =
+            match lhs.pexpr_desc with
+            | PEident id -> ident ~use:false ctx id
+            | _ -> typecheck_rec lhs
+          in
+          ExprAnalysis.require_variable ~loc ~action:"assign to" lhs te;
+          ExprAnalysis.require_addressable ~loc ~assign:true te;
+          te
+    in
+    let t_lhs_list = List.map2 typecheck_lhs lhs_list unpacked_rhs_types in
+    let lhs_types = List.map (fun l -> l.expr_typ) t_lhs_list in
+    let t_rhs_list = ExprAnalysis.convert_all ~loc lhs_types t_rhs_list in
+    let unpacked_rhs_types =
+      match t_rhs_list with
+      | [ { expr_typ = Tmany types } ] -> types
+      | _ -> List.map (fun r -> r.expr_typ) t_rhs_list
+    in
+
     ArityChecker.check_type_match ~loc ~expected:lhs_types
       ~actual:unpacked_rhs_types ~context:"assignment";
 
@@ -218,10 +1347,9 @@ module ExprTypecheck = struct
       expr_typ = ResultType.empty;
     }
 
-  let deduce_var_types ctx loc ident_list opt_typ init_types =
-    match opt_typ with
-    | Some ptyp ->
-        let typ = Types.from_ptyp ctx.structs ptyp in
+  let deduce_var_types loc ident_list declared init_types =
+    match declared with
+    | Some typ ->
         (* Only check if we have init expressions *)
         if List.length init_types > 0 then
           ArityChecker.check_type_match ~loc
@@ -240,11 +1368,9 @@ module ExprTypecheck = struct
 
   let create_or_reuse_var ctx ident deduced_type =
     (* Check if this identifier is the blank identifier *)
-    if Constants.is_blank ident.id then (
-      (* Blank identifier: always create a new variable, never error *)
-      let v = new_var ident.id ident.loc deduced_type in
-      VarEnv.add_var ctx.vars v;
-      v)
+    if Constants.is_blank ident.id then
+      (* Blank identifier: never visible, so never added to the scope *)
+      new_var ident.id ident.loc deduced_type
     else
       (* Regular identifier: check for redeclaration in current scope only *)
       match VarEnv.find_current_scope ctx.vars ident.id with
@@ -257,10 +1383,18 @@ module ExprTypecheck = struct
           VarEnv.add_var ctx.vars v;
           v
 
+  (* var x1,...,xn = e1,...,en => var x1,...,xn; x1,...,xn = e1,...,en *)
   let vars ctx typecheck_rec ident_list opt_typ init_exprs loc : expr =
-    let init_types =
-      List.map (fun expr -> (typecheck_rec expr).expr_typ) init_exprs
+    let declared = option_map (typ typecheck_rec ctx) opt_typ in
+    let typed_inits =
+      values typecheck_rec (List.length ident_list) init_exprs
+    in
+    let typed_inits =
+      match declared with
+      | Some t -> List.map (ExprAnalysis.convert ~loc t) typed_inits
+      | None -> typed_inits
     in
+    let init_types = List.map (fun te -> te.expr_typ) typed_inits in
 
     (* Only unpack and check arity if we have init expressions *)
     let unpacked_init_types =
@@ -272,17 +1406,162 @@ module ExprTypecheck = struct
     in
 
     let deduced_types =
-      deduce_var_types ctx loc ident_list opt_typ unpacked_init_types
+      deduce_var_types loc ident_list declared unpacked_init_types
     in
 
     let created_variables =
       List.map2 (create_or_reuse_var ctx) ident_list deduced_types
     in
-    { expr_desc = TEvars created_variables; expr_typ = ResultType.empty }
+    let decl =
+      { expr_desc = TEvars created_variables; expr_typ = ResultType.empty }
+    in
+    if typed_inits = [] then decl
+    else
+      let lhs =
+        List.map
+          (fun v -> { expr_desc = TEident v; expr_typ = v.v_typ })
+          created_variables
+      in
+      let init =
+        { expr_desc = TEassign (lhs, typed_inits); expr_typ = ResultType.empty }
+      in
+      { expr_desc = TEblock [ decl; init ]; expr_typ = ResultType.empty }
+
+  (* x1,...,xn := e1,...,en declares those xi not in the current scope yet,
+     at least one, and assigns the others:
+     => var (new xi); x1,...,xn = e1,...,en *)
+  let define ctx typecheck_rec ident_list init_exprs loc : expr =
+    let rec check_repeated = function
+      | [] -> ()
+      | (id : ident) :: rest ->
+          (if not (Constants.is_blank id.id) then
+             match List.find_opt (fun (x : ident) -> x.id = id.id) rest with
+             | Some x ->
+                 errorm ~loc:x.loc "%s repeated on left side of :=" x.id
+             | None -> ());
+          check_repeated rest
+    in
+    check_repeated ident_list;
+    let declared (id : ident) =
+      if Constants.is_blank id.id then None
+      else VarEnv.find_current_scope ctx.vars id.id
+    in
+    let previous = List.map declared ident_list in
+    let is_new (id : ident) = declared id = None in
+    if not (List.exists
+              (fun (id : ident) -> is_new id && not (Constants.is_blank id.id))
+              ident_list)
+    then errorm ~loc "no new variables on left side of :=";
+    if List.for_all is_new ident_list then
+      vars ctx typecheck_rec ident_list None init_exprs loc
+    else
+      let typed_inits =
+        values typecheck_rec (List.length ident_list) init_exprs
+      in
+      let init_types =
+        ArityChecker.unpack_and_check ~loc
+          ~expected_count:(List.length ident_list)
+          ~actual_types:(List.map (fun te -> te.expr_typ) typed_inits)
+          ~context:"assignment"
+      in
+      let lhs_types =
+        List.map2
+          (fun v t -> match v with Some v -> v.v_typ | None -> t)
+          previous init_types
+      in
+      let typed_inits = ExprAnalysis.convert_all ~loc lhs_types typed_inits in
+      let value_types =
+        match typed_inits with
+        | [ { expr_typ = Tmany types } ] -> types
+        | _ -> List.map (fun te -> te.expr_typ) typed_inits
+      in
+      ArityChecker.check_type_match ~loc ~expected:lhs_types
+        ~actual:value_types ~context:"assignment";
+      (* the new variables come into scope after the values are typed *)
+      let variable (id : ident) typ = function
+        | Some v when v.v_const <> None ->
+            errorm ~loc:id.loc "cannot assign to %s (constant)" id.id
+        | Some v -> (v, false)
+        | None ->
+            if Types.is_nil typ then
+              errorm ~loc "cannot deduce type from nil initial value";
+            (create_or_reuse_var ctx id typ, true)
+      in
+      let variables =
+        List.map2 (fun (id, typ) v -> variable id typ v)
+          (List.combine ident_list lhs_types) previous
+      in
+      let created =
+        List.filter_map
+          (fun (v, fresh) -> if fresh then Some v else None)
+          variables
+      in
+      let lhs =
+        List.map
+          (fun (v, _) -> { expr_desc = TEident v; expr_typ = v.v_typ })
+          variables
+      in
+      let decl = { expr_desc = TEvars created; expr_typ = ResultType.empty } in
+      let init =
+        { expr_desc = TEassign (lhs, typed_inits); expr_typ = ResultType.empty }
+      in
+      { expr_desc = TEblock [ decl; init ]; expr_typ = ResultType.empty }
+
+  (* the values are computed here and bound in the current scope; every
+     reference is then replaced by the value, so constants take no storage *)
+  let const_spec typecheck_fn ctx (c : pconst) =
+    let loc = (List.hd c.pc_names).loc in
+    if c.pc_values = [] then
+      errorm ~loc "missing init expr for const declaration";
+    if List.length c.pc_values <> List.length c.pc_names then
+      errorm ~loc "const declaration arity mismatch: expected %d, got %d"
+        (List.length c.pc_names) (List.length c.pc_values);
+    let declared = option_map (typ (typecheck_fn ctx) ctx) c.pc_typ in
+    let ctx' = { ctx with iota = Some c.pc_iota } in
+    List.iter2
+      (fun ident value ->
+        let te = typecheck_fn ctx' value in
+        if not (ExprAnalysis.is_constant te) then
+          errorm ~loc:value.pexpr_loc "%s is not constant" ident.id;
+        (* a constant declared with a type is typed, as T(e) is *)
+        let te, typ =
+          match declared with
+          | Some t ->
+              ( ExprAnalysis.value ~loc:value.pexpr_loc t te
+                  "const declaration",
+                t )
+          | None -> (te, te.expr_typ)
+        in
+        (* an untyped integer beyond int64 is only reported where it is
+           used as a value *)
+        let desc =
+          match (te.expr_desc, ConstEval.eval ~loc:value.pexpr_loc te) with
+          | (TEexact _ as d), _ -> d
+          | _, Some c when declared = None && ExprAnalysis.untyped te ->
+              TEconstant c
+          | _, Some c -> TEtyped c
+          | _, None ->
+              errorm ~loc:value.pexpr_loc "%s is not constant" ident.id
+        in
+        if not (Constants.is_blank ident.id) then begin
+          (match VarEnv.find_current_scope ctx.vars ident.id with
+          | Some v when not (Constants.is_blank v.v_name) ->
+              errorm ~loc:ident.loc
+                "constant %s already declared (previous declaration at %s)"
+                ident.id (string_of_loc v.v_loc)
+          | _ -> ());
+          VarEnv.add_var ctx.vars (new_const ident.id ident.loc typ desc)
+        end)
+      c.pc_names c.pc_values
+
+  let consts typecheck_fn ctx pconsts : expr =
+    List.iter (const_spec typecheck_fn ctx) pconsts;
+    skip ()
 
   let if_expr typecheck_rec cond then_branch else_branch cond_loc : expr =
     let cond_typed = typecheck_rec cond in
-    ExprAnalysis.require_type ~loc:cond_loc Tbool cond_typed.expr_typ
+    ExprAnalysis.require_type ~loc:cond_loc Tbool
+      (Types.underlying cond_typed.expr_typ)
       "if condition";
     let then_typed = typecheck_rec then_branch in
     let else_typed = typecheck_rec else_branch in
@@ -291,8 +1570,11 @@ module ExprTypecheck = struct
       expr_typ = ResultType.empty;
     }
 
-  let return ctx typecheck_rec exprs loc : expr =
-    let typed_exprs = List.map typecheck_rec exprs in
+  let return_values ctx typecheck_rec exprs loc : expr =
+    let typed_exprs =
+      ExprAnalysis.convert_all ~loc ctx.expected_return
+        (List.map typecheck_rec exprs)
+    in
     let return_types = List.map (fun te -> te.expr_typ) typed_exprs in
 
     let unpacked_return_types =
@@ -306,49 +1588,281 @@ module ExprTypecheck = struct
 
     { expr_desc = TEreturn typed_exprs; expr_typ = ResultType.empty }
 
-  let block typecheck_fn ctx exprs : expr =
-    let ctx' = push_scope_ctx ctx in
-    let typed_exprs = List.map (typecheck_fn ctx') exprs in
+  (* a naked return returns the current values of the named results, that
+     must not be shadowed there; those named _ are never in scope *)
+  let return ctx typecheck_rec exprs loc : expr =
+    match (exprs, ctx.results) with
+    | [], (_ :: _ as results) ->
+        let result v =
+          (match VarEnv.find_global ctx.vars v.v_name with
+          | Some v' when v' == v -> ()
+          | _ when Constants.is_blank_result v.v_name -> ()
+          | _ ->
+              errorm ~loc "result parameter %s not in scope at return"
+                v.v_name);
+          { expr_desc = TEident v; expr_typ = v.v_typ }
+        in
+        {
+          expr_desc = TEreturn (List.map result results);
+          expr_typ = ResultType.empty;
+        }
+    | _ -> return_values ctx typecheck_rec exprs loc
+
+  let label name = { expr_desc = TElabel name; expr_typ = ResultType.empty }
+
+  (* the label that continue L jumps to ends the body of the loop labeled
+     L, which may follow the initialization of its header *)
+  let rec continue_label name (te : expr) : expr =
+    match te.expr_desc with
+    | TEfor (cond, post, body) ->
+        let body = { body with expr_desc = TEblock [ body; label name ] } in
+        { te with expr_desc = TEfor (cond, post, body) }
+    | TEblock el -> (
+        match List.rev el with
+        | last :: rev ->
+            let el = List.rev (continue_label name last :: rev) in
+            { te with expr_desc = TEblock el }
+        | [] -> te)
+    | _ -> te
+
+  (* L: s is preceded by the label L, and followed by the label that break L
+     jumps to *)
+  let labeled name (s : pexpr) stmts =
+    match Validation.label_target s with
+    | Statement -> label name :: stmts
+    | Switch -> (label name :: stmts) @ [ label (Constants.break_label name) ]
+    | Loop ->
+        let loop = continue_label (Constants.continue_label name) in
+        (label name :: List.map loop stmts)
+        @ [ label (Constants.break_label name) ]
+
+  (* the body of a function is in the scope of its parameters *)
+  let block ?(scope = true) typecheck_fn ctx exprs : expr =
+    let ctx' = if scope then push_scope_ctx ctx else ctx in
+    (* declarations are spliced into the block so that the variables stay
+       visible to the following statements after rewriting; each statement
+       is preceded by its position, for the line table *)
+    let rec typecheck_stmt e =
+      let line =
+        { expr_desc = TEline e.pexpr_loc; expr_typ = ResultType.empty }
+      in
+      match e.pexpr_desc with
+      | PElabel (id, s) -> labeled id.id s (typecheck_stmt s)
+      | _ -> (
+          match (e.pexpr_desc, typecheck_fn ctx' e) with
+          | (PEvars _ | PEdefine _), { expr_desc = TEblock decl } ->
+              line :: decl
+          | _, te ->
+              ExprAnalysis.require_statement e te;
+              [ line; te ])
+    in
+    let typed_exprs = List.concat_map typecheck_stmt exprs in
     { expr_desc = TEblock typed_exprs; expr_typ = ResultType.empty }
 
-  let for_loop typecheck_fn ctx cond block cond_loc : expr =
+  let for_loop typecheck_fn ctx cond post block cond_loc : expr =
     let ctx' = push_scope_ctx ctx in
     let cond_typed = typecheck_fn ctx' cond in
-    ExprAnalysis.require_type ~loc:cond_loc Tbool cond_typed.expr_typ
+    ExprAnalysis.require_type ~loc:cond_loc Tbool
+      (Types.underlying cond_typed.expr_typ)
       "for condition";
-    let block_typed = typecheck_fn ctx' block in
-    { expr_desc = TEfor (cond_typed, block_typed); expr_typ = ResultType.empty }
+    (match post.pexpr_desc with
+    | PEvars _ | PEdefine _ ->
+        errorm ~loc:post.pexpr_loc "cannot declare in post statement"
+    | _ -> ());
+    let post_typed = typecheck_fn ctx' post in
+    ExprAnalysis.require_statement post post_typed;
+    let block_typed = typecheck_fn { ctx' with in_loop = true } block in
+    {
+      expr_desc = TEfor (cond_typed, post_typed, block_typed);
+      expr_typ = ResultType.empty;
+    }
 
   let incdec typecheck_rec expr incdec loc : expr =
     ExprAnalysis.require_lvalue ~loc expr;
     let t_expr = typecheck_rec expr in
-    ExprAnalysis.require_type ~loc Tint t_expr.expr_typ "increment/decrement";
-    { expr_desc = TEincdec (t_expr, incdec); expr_typ = Tint }
+    ExprAnalysis.require_variable ~loc ~action:"assign to" expr t_expr;
+    ExprAnalysis.require_addressable ~loc ~assign:true t_expr;
+    (match Types.underlying t_expr.expr_typ with
+    | Tint | Tinteger _ | Tfloat -> ()
+    | _ ->
+        errorm ~loc "operator %s requires a numeric operand, got %s"
+          (match incdec with Inc -> "++" | Dec -> "--")
+          (Types.to_string t_expr.expr_typ));
+    { expr_desc = TEincdec (t_expr, incdec); expr_typ = ResultType.empty }
+
+  (* x op= e is checked as x = x op e, but x is evaluated only once *)
+  let op_assign typecheck_rec op lhs rhs loc : expr =
+    ExprAnalysis.require_lvalue ~loc lhs;
+    let t_lhs = typecheck_rec lhs in
+    ExprAnalysis.require_variable ~loc ~action:"assign to" lhs t_lhs;
+    ExprAnalysis.require_addressable ~loc ~assign:true t_lhs;
+    let t_rhs = typecheck_rec rhs in
+    let t_rhs =
+      match op with
+      | Bshl | Bshr -> t_rhs
+      | _ -> ExprAnalysis.convert ~loc:rhs.pexpr_loc t_lhs.expr_typ t_rhs
+    in
+    ignore (OperatorChecker.check_binop ~loc op t_lhs.expr_typ t_rhs.expr_typ);
+    check_division ~loc:rhs.pexpr_loc op t_rhs;
+    check_shift ~loc:rhs.pexpr_loc op t_rhs;
+    { expr_desc = TEopassign (op, t_lhs, t_rhs); expr_typ = ResultType.empty }
+
+  let jump ~allowed desc message loc : expr =
+    if not allowed then errorm ~loc "%s" message;
+    { expr_desc = desc; expr_typ = ResultType.empty }
+
+  let goto label : expr =
+    { expr_desc = TEgoto label; expr_typ = ResultType.empty }
+
+  (* defer f(e1, ..., en) evaluates e1, ..., en at once, and calls f when
+     the function returns; so that they can be kept, a call of several
+     results cannot be one of them *)
+  let defer typecheck_rec (call : pexpr) : expr =
+    let te =
+      match call.pexpr_desc with
+      | PEcall _ -> typecheck_rec call
+      | _ ->
+          errorm ~loc:call.pexpr_loc "expression in defer must be function call"
+    in
+    let several el =
+      List.exists (fun e -> match e.expr_typ with Tmany _ -> true | _ -> false) el
+    in
+    match te.expr_desc with
+    | (TEcall (_, el) | TEprint el) when several el ->
+        errorm ~loc:call.pexpr_loc
+          "a deferred call cannot take the results of another call"
+    | TEcall _ | TEprint _ | TEprintf _ | TEsprintf _ | TEpanic _ | TEdelete _
+    | TEexit _ ->
+        { expr_desc = TEdefer te; expr_typ = ResultType.empty }
+    | TElen _ -> errorm ~loc:call.pexpr_loc "defer discards result of len"
+    | TEappend _ -> errorm ~loc:call.pexpr_loc "defer discards result of append"
+    | TEnew _ -> errorm ~loc:call.pexpr_loc "defer discards result of new"
+    | _ ->
+        errorm ~loc:call.pexpr_loc "defer requires function call, not conversion"
+
+  let switch_tag typecheck_fn ctx tag =
+    let te = typecheck_fn ctx tag in
+    ExprAnalysis.require_representable ~loc:tag.pexpr_loc te;
+    (match te.expr_typ with
+    | Tmany _ | Tnil ->
+        errorm ~loc:tag.pexpr_loc "switch tag must be a single value, got %s"
+          (Types.to_string te.expr_typ)
+    | _ -> ());
+    let v = new_var "switch" tag.pexpr_loc te.expr_typ in
+    v.v_used <- true;
+    (v, te)
+
+  (* switch e { case v1, v2: ... } =>
+     var t = e; switch { case t == v1, t == v2: ... }
+     so that the tag is evaluated once, before any case value *)
+  let switch typecheck_fn ctx tag clauses : expr =
+    let tag = option_map (switch_tag typecheck_fn ctx) tag in
+    let seen = ref [] in
+    let condition (value : pexpr) =
+      let te = typecheck_fn ctx value in
+      let loc = value.pexpr_loc in
+      match tag with
+      | None ->
+          ExprAnalysis.require_type ~loc Tbool (Types.underlying te.expr_typ)
+            "case condition";
+          te
+      | Some (v, tag_typed) ->
+          let te = ExprAnalysis.convert ~loc tag_typed.expr_typ te in
+          (match te.expr_desc with
+          | (TEconstant c | TEtyped c) when List.mem c !seen ->
+              errorm ~loc "duplicate case in switch"
+          | TEconstant c | TEtyped c -> seen := c :: !seen
+          | _ -> ());
+          if not (Types.equal tag_typed.expr_typ te.expr_typ) then
+            errorm ~loc "case value has type %s, but the switch tag has type %s"
+              (Types.to_string te.expr_typ)
+              (Types.to_string tag_typed.expr_typ);
+          let t = { expr_desc = TEident v; expr_typ = v.v_typ } in
+          let typ = OperatorChecker.check_binop ~loc Beq v.v_typ te.expr_typ in
+          { expr_desc = TEbinop (Beq, t, te); expr_typ = typ }
+    in
+    let defaults = List.filter (function None, _ -> true | _ -> false) clauses in
+    if List.length defaults > 1 then
+      errorm ~loc:(snd (List.nth defaults 1)).pexpr_loc
+        "multiple defaults in switch";
+    let last = List.length clauses - 1 in
+    let clause i ((values, body) : pcase) =
+      let conditions = option_map (List.map condition) values in
+      (* a final fallthrough is taken out of the body, any other one is
+         rejected as out of place *)
+      let stmts = match body.pexpr_desc with PEblock l -> l | _ -> [ body ] in
+      let stmts, fallthrough =
+        match List.rev stmts with
+        | { pexpr_desc = PEfallthrough; pexpr_loc = loc } :: rest ->
+            if i = last then
+              errorm ~loc "cannot fallthrough final case in switch";
+            (List.rev rest, true)
+        | _ -> (stmts, false)
+      in
+      let body_typed =
+        typecheck_fn
+          { ctx with in_switch = true }
+          { body with pexpr_desc = PEblock stmts }
+      in
+      (conditions, body_typed, fallthrough)
+    in
+    let te =
+      {
+        expr_desc = TEswitch (List.mapi clause clauses);
+        expr_typ = ResultType.empty;
+      }
+    in
+    match tag with
+    | None -> te
+    | Some (v, tag_typed) ->
+        let t = { expr_desc = TEident v; expr_typ = v.v_typ } in
+        let stmt d = { expr_desc = d; expr_typ = ResultType.empty } in
+        stmt
+          (TEblock
+             [ stmt (TEvars [ v ]); stmt (TEassign ([ t ], [ tag_typed ])); te ])
 end
 
 (** Main recursive type checking function for expressions *)
 let rec typecheck_expr (ctx : typing_context) (fmt_print_used : bool ref)
     (e : pexpr) : expr =
-  let typecheck_rec = typecheck_expr ctx fmt_print_used in
+  let typecheck_rec = typecheck_value ctx fmt_print_used in
+  let typecheck_operand = typecheck_operand ctx fmt_print_used in
 
   match e.pexpr_desc with
   | PEskip -> ExprTypecheck.skip ()
+  | PEconstant (Cint n) when n = Int64.min_int ->
+      (* the lexer reads 9223372036854775808 as min_int, which is only a
+         valid int when negated *)
+      {
+        expr_desc = TEexact (Bigint.neg (Bigint.of_int64 n));
+        expr_typ = Tint;
+      }
   | PEconstant c -> ExprTypecheck.constant c
+  | PErune n -> { expr_desc = TEconstant (Cint n); expr_typ = Types.rune }
   | PEbinop (op, e1, e2) ->
-      ExprTypecheck.binop typecheck_rec op e1 e2 e.pexpr_loc
-  | PEunop (op, e1) -> ExprTypecheck.unop typecheck_rec op e1 e.pexpr_loc
+      ExprTypecheck.binop typecheck_operand op e1 e2 e.pexpr_loc
+  | PEunop (op, e1) -> ExprTypecheck.unop typecheck_operand op e1 e.pexpr_loc
   | PEnil -> ExprTypecheck.nil ()
   | PEcall (ident, pexpr_list) ->
-      ExprTypecheck.call ctx typecheck_rec ident pexpr_list e.pexpr_loc
-        fmt_print_used
+      ExprTypecheck.call ctx typecheck_rec typecheck_operand ident pexpr_list
+        e.pexpr_loc fmt_print_used
   | PEident ident -> ExprTypecheck.ident ctx ident
   | PEdot (base_expr, field_ident) ->
-      ExprTypecheck.dot typecheck_rec base_expr field_ident
+      ExprTypecheck.dot ctx typecheck_rec base_expr field_ident
+  | PEindex (base_expr, index_expr) ->
+      ExprTypecheck.index typecheck_rec base_expr index_expr e.pexpr_loc
+  | PEcomposite (Some ptyp, elements) ->
+      let typ = ExprTypecheck.typ typecheck_rec ctx ptyp in
+      ExprTypecheck.composite typecheck_rec typ elements e.pexpr_loc
+  | PEcomposite (None, _) ->
+      errorm ~loc:e.pexpr_loc "missing type in composite literal"
   | PEassign (lhs_list, rhs_list) ->
-      ExprTypecheck.assign typecheck_rec lhs_list rhs_list e.pexpr_loc
+      ExprTypecheck.assign ctx typecheck_rec lhs_list rhs_list e.pexpr_loc
   | PEvars (ident_list, opt_typ, init_exprs) ->
       ExprTypecheck.vars ctx typecheck_rec ident_list opt_typ init_exprs
         e.pexpr_loc
+  | PEdefine (ident_list, init_exprs) ->
+      ExprTypecheck.define ctx typecheck_rec ident_list init_exprs e.pexpr_loc
   | PEif (cond, then_branch, else_branch) ->
       ExprTypecheck.if_expr typecheck_rec cond then_branch else_branch
         cond.pexpr_loc
@@ -357,9 +1871,63 @@ let rec typecheck_expr (ctx : typing_context) (fmt_print_used : bool ref)
       ExprTypecheck.block
         (fun ctx -> typecheck_expr ctx fmt_print_used)
         ctx exprs
-  | PEfor (cond, block) ->
+  | PEfor (cond, post, block) ->
       ExprTypecheck.for_loop
         (fun ctx -> typecheck_expr ctx fmt_print_used)
-        ctx cond block cond.pexpr_loc
+        ctx cond post block cond.pexpr_loc
   | PEincdec (expr, incdec) ->
       ExprTypecheck.incdec typecheck_rec expr incdec expr.pexpr_loc
+  | PEopassign (op, lhs, rhs) ->
+      ExprTypecheck.op_assign typecheck_rec op lhs rhs e.pexpr_loc
+  | PEbreak None ->
+      ExprTypecheck.jump
+        ~allowed:(ctx.in_loop || ctx.in_switch)
+        TEbreak "break is not in a loop or switch" e.pexpr_loc
+  | PEcontinue None ->
+      ExprTypecheck.jump ~allowed:ctx.in_loop TEcontinue
+        "continue is not in a loop" e.pexpr_loc
+  (* the labels were checked with the function, see Validation.check_labels *)
+  | PEbreak (Some id) -> ExprTypecheck.goto (Constants.break_label id.id)
+  | PEcontinue (Some id) -> ExprTypecheck.goto (Constants.continue_label id.id)
+  | PEgoto id -> ExprTypecheck.goto id.id
+  | PElabel _ -> assert false (* split by the enclosing block *)
+  | PEswitch (tag, clauses) ->
+      ExprTypecheck.switch
+        (fun ctx -> typecheck_expr ctx fmt_print_used)
+        ctx tag clauses
+  | PEfallthrough ->
+      errorm ~loc:e.pexpr_loc "fallthrough statement out of place"
+  | PEdefer call ->
+      ExprTypecheck.defer (typecheck_expr ctx fmt_print_used) call
+  | PEspread _ ->
+      errorm ~loc:e.pexpr_loc
+        "can only use ... with the last argument of a variadic function"
+  | PEconsts pconsts ->
+      ExprTypecheck.consts
+        (fun ctx -> typecheck_expr ctx fmt_print_used)
+        ctx pconsts
+
+(** An expression of which the value is used *)
+and typecheck_value ctx fmt_print_used (e : pexpr) : expr =
+  let te = typecheck_operand ctx fmt_print_used e in
+  ExprAnalysis.require_representable ~loc:e.pexpr_loc te;
+  te
+
+(** An operand of a constant, that can be an untyped integer beyond int64 *)
+and typecheck_operand ctx fmt_print_used (e : pexpr) : expr =
+  let te = typecheck_expr ctx fmt_print_used e in
+  ExprAnalysis.require_value e te;
+  te
+
+(** Body of a function, typed in the scope of its parameters [ctx] *)
+let function_body ctx fmt_print_used (body : pexpr) =
+  match body.pexpr_desc with
+  | PEblock exprs ->
+      ExprTypecheck.block ~scope:false
+        (fun ctx -> typecheck_expr ctx fmt_print_used)
+        ctx exprs
+  | _ -> typecheck_expr ctx fmt_print_used body
+
+(** Length of an array type, evaluated in [ctx] *)
+let array_length ctx fmt_print_used =
+  ExprTypecheck.array_length (typecheck_expr ctx fmt_print_used)
@@ -5,29 +5,147 @@ open Typing_error
 
 (** Type operations module *)
 module Types = struct
+  let rune = Tinteger (32, true)
+  let byte = Tinteger (8, false)
+
+  (* uint has 64 bits, and is not told apart from uint64 *)
+  let uint = Tinteger (64, false)
+
   let builtin_of_string = function
     | "int" -> Some Tint
     | "bool" -> Some Tbool
     | "string" -> Some Tstring
+    | "float64" -> Some Tfloat
+    | "rune" -> Some rune
+    | "byte" | "uint8" -> Some byte
+    | "uint16" -> Some (Tinteger (16, false))
+    | "uint32" -> Some (Tinteger (32, false))
+    | "uint" | "uint64" -> Some uint
     | _ -> None
 
-  let rec from_ptyp (struct_env : (string, structure) Hashtbl.t) (pt : ptyp) : typ =
+  (* the values of a named type are those of its underlying type, and so
+     are the operations on them *)
+  let underlying = function Tnamed (_, t) -> Lazy.force t | t -> t
+
+  let is_integer t =
+    match underlying t with Tint | Tinteger _ -> true | _ -> false
+
+  let is_float t = underlying t = Tfloat
+  let is_string t = underlying t = Tstring
+  let is_bool t = underlying t = Tbool
+
+  (* the smallest and largest values of an integer type, as 64-bit signed
+     integers: the values of uint64 above max_int are negative ones, and
+     are only told apart by their type *)
+  let integer_bounds t =
+    match underlying t with
+    | Tinteger (bits, true) when bits < 64 ->
+        let m = Int64.shift_left 1L (bits - 1) in
+        (Int64.neg m, Int64.pred m)
+    | Tinteger (bits, false) when bits < 64 ->
+        (0L, Int64.pred (Int64.shift_left 1L bits))
+    | Tinteger (_, false) -> (0L, Int64.max_int)
+    | _ -> (Int64.min_int, Int64.max_int)
+
+  let rec ptyp_loc = function
+    | PTident id -> id.loc
+    | PTarray (e, _) -> e.pexpr_loc
+    | PTptr pt | PTslice pt | PTmap (pt, _) -> ptyp_loc pt
+
+  (* the keys of a map are compared as 64-bit values, or as strings *)
+  let is_map_key t =
+    match underlying t with
+    | Tint | Tinteger _ | Tbool | Tstring | Tfloat | Tptr _ -> true
+    | _ -> false
+
+  (* the types declared by type T U and type T = U, by name, and those of
+     them already resolved; a declaration is resolved when it is first
+     used, so that it can refer to the ones that follow it *)
+  let declared : (string, ptype) Hashtbl.t = Hashtbl.create 16
+  let named : (string, typ) Hashtbl.t = Hashtbl.create 16
+
+  (* the declarations being resolved, with the number of pointers, slices
+     and maps the type being built was inside of when each one started;
+     and the map keys of a type being resolved, checked once it is *)
+  let resolving = ref []
+  let indirections = ref 0
+  let keys = ref []
+
+  (* [length] evaluates the constant length of an array type *)
+  let rec from_ptyp ~(length : pexpr -> int)
+      (struct_env : (string, structure) Hashtbl.t) (pt : ptyp) : typ =
     match pt with
     | PTident id -> (
         match builtin_of_string id.id with
         | Some t -> t
         | None -> (
-            match Hashtbl.find_opt struct_env id.id with
-            | Some s -> Tstruct s
-            | None ->
-                errorm ~loc:id.loc "undefined structure: %s used as a type" id.id))
-    | PTptr pt' -> Tptr (from_ptyp struct_env pt')
+            match Hashtbl.find_opt named id.id with
+            | Some t -> t
+            | None -> (
+                match
+                  (Hashtbl.find_opt declared id.id,
+                   Hashtbl.find_opt struct_env id.id)
+                with
+                | Some d, _ -> resolve ~length struct_env d
+                | None, Some s -> Tstruct s
+                | None, None ->
+                    errorm ~loc:id.loc "undefined structure: %s used as a type"
+                      id.id)))
+    | PTptr pt' -> Tptr (indirect ~length struct_env pt')
+    | PTarray (e, pt') ->
+        let n = length e in
+        Tarray (from_ptyp ~length struct_env pt', n)
+    | PTslice pt' -> Tslice (indirect ~length struct_env pt')
+    | PTmap (pk, pv) ->
+        let k = from_ptyp ~length struct_env pk in
+        (match k with
+        | Tnamed (name, _) when List.mem_assoc name !resolving ->
+            keys := (name, pk, k) :: !keys
+        | _ -> check_map_key pk k);
+        Tmap (k, indirect ~length struct_env pv)
+
+  (* the values of a pointer, a slice or a map are not held in it *)
+  and indirect ~length struct_env pt =
+    incr indirections;
+    let t = from_ptyp ~length struct_env pt in
+    decr indirections;
+    t
+
+  and check_map_key pk k =
+    if not (is_map_key k) then
+      errorm ~loc:(ptyp_loc pk) "invalid map key type %s"
+        (Utils.string_of_typ k)
+
+  (* a type cannot hold a value of itself, but may refer to itself through
+     a pointer, a slice or a map, its underlying type being then the one
+     it is being resolved to; an alias cannot refer to itself at all *)
+  and resolve ~length struct_env (d : ptype) : typ =
+    let name = d.pt_name.id in
+    match List.assoc_opt name !resolving with
+    | Some depth when depth < !indirections && not d.pt_alias ->
+        Tnamed (name, lazy (underlying (Hashtbl.find named name)))
+    | Some _ -> errorm ~loc:d.pt_name.loc "invalid recursive type %s" name
+    | None ->
+        resolving := (name, !indirections) :: !resolving;
+        let t = from_ptyp ~length struct_env d.pt_typ in
+        resolving := List.tl !resolving;
+        let t =
+          if d.pt_alias then t else Tnamed (name, Lazy.from_val (underlying t))
+        in
+        Hashtbl.replace named name t;
+        let checked, rest = List.partition (fun (n, _, _) -> n = name) !keys in
+        keys := rest;
+        List.iter (fun (_, pk, k) -> check_map_key pk k) checked;
+        t
 
   let to_string = Utils.string_of_typ
   let equal = Utils.types_equal
   let is_nil = function Tnil -> true | _ -> false
-  let is_pointer = function Tptr _ -> true | _ -> false
-  let is_struct = function Tstruct _ -> true | _ -> false
+  let is_pointer t = match underlying t with Tptr _ -> true | _ -> false
+  let is_struct t = match underlying t with Tstruct _ -> true | _ -> false
+  let is_array t = match underlying t with Tarray _ -> true | _ -> false
+  let is_slice t = match underlying t with Tslice _ -> true | _ -> false
+  let is_map t = match underlying t with Tmap _ -> true | _ -> false
 end
 
 (** Result type construction utilities *)
@@ -38,11 +156,42 @@ end
 
 (** Constants used throughout the typechecker *)
 module Constants = struct
-  let builtin_types = [ "int"; "bool"; "string" ]
+  let builtin_types =
+    [ "int"; "bool"; "string"; "float64"; "rune"; "byte" ]
+    @ [ "uint"; "uint8"; "uint16"; "uint32"; "uint64" ]
   let blank_identifier = "_"
   let main_function = "main"
   let new_keyword = "new"
+  let len_builtin = "len"
+  let append_builtin = "append"
+  let delete_builtin = "delete"
+  let panic_builtin = "panic"
+  let iota = "iota"
   let fmt_print = "fmt.Print"
+  let fmt_println = "fmt.Println"
+  let fmt_printf = "fmt.Printf"
+  let fmt_sprintf = "fmt.Sprintf"
+  let fmt_functions = [ fmt_print; fmt_println; fmt_printf; fmt_sprintf ]
+  let os_exit = "os.Exit"
+  let os_package = "os"
+  let os_args = "Args"
+
+  (* the functions a package provides once imported *)
+  let package_functions = function
+    | "fmt" -> fmt_functions
+    | "os" -> [ os_exit ]
+    | _ -> []
   let is_blank name = name = blank_identifier
+
+  (* a result named _ still needs a variable, named ~r0, ~r1, ... after its
+     position so that it cannot be referred to *)
+  let blank_result i = "~r" ^ string_of_int i
+  let is_blank_result name = String.length name > 0 && name.[0] = '~'
   let is_builtin_type name = List.mem name builtin_types
+
+  (* break L and continue L are gotos to labels that cannot be written in
+     Go, after the statement labeled L and at the end of the loop body *)
+  let break_label name = name ^ ".break"
+  let continue_label name = name ^ ".continue"
+  let is_break_label label = Filename.check_suffix label ".break"
 end
\ No newline at end of file
@@ -12,7 +12,7 @@ module ArityChecker = struct
   (** Unpack Tmany if needed and verify arity *)
   let unpack_and_check ~loc ~expected_count ~actual_types ~context =
     match actual_types with
-    | [ Tmany types ] when expected_count > 1 ->
+    | [ Tmany types ] ->
         if List.length types <> expected_count then
           errorm ~loc "%s arity mismatch: expected %d, got %d" 
             context expected_count (List.length types);
@@ -38,22 +38,43 @@ module ArityChecker = struct
         context (Types.to_string expected) (Types.to_string actual)
 end
 
+(** What a break or a continue naming the label of a statement can leave *)
+type label_target = Loop | Switch | Statement
+
 (** Validation module for checking duplicates and cycles *)
 module Validation = struct
   let check_no_duplicate_functions (funcs : pfunc list) : unit =
     check_duplicates
       ~get_key:(fun (ident, _typ) -> ident.id)
-      ~on_duplicate:(fun (ident, _typ) ->
-        errorm ~loc:ident.loc "duplicate function: %s" ident.id)
+      ~on_duplicate:(fun (first, _) (ident, _typ) ->
+        errorm ~loc:ident.loc
+          "duplicate function: %s (previous declaration at %s)" ident.id
+          (string_of_loc first.loc))
       (List.filter_map (fun f -> Some (f.pf_name, f.pf_typ)) funcs)
 
   let check_no_duplicate_structs (structs : pstruct list) : unit =
     check_duplicates
       ~get_key:(fun ident -> ident.id)
-      ~on_duplicate:(fun ident ->
-        errorm ~loc:ident.loc "duplicate structure: %s" ident.id)
+      ~on_duplicate:(fun first ident ->
+        errorm ~loc:ident.loc
+          "duplicate structure: %s (previous declaration at %s)" ident.id
+          (string_of_loc first.loc))
       (List.filter_map (fun s -> Some s.ps_name) structs)
 
+  (** the structures and the other declared types share their names *)
+  let check_no_duplicate_types (dl : pdecl list) : unit =
+    check_duplicates
+      ~get_key:(fun ident -> ident.id)
+      ~on_duplicate:(fun first ident ->
+        errorm ~loc:ident.loc "duplicate type: %s (previous declaration at %s)"
+          ident.id (string_of_loc first.loc))
+      (List.filter_map
+         (function
+           | PDstruct s -> Some s.ps_name
+           | PDtype t -> Some t.pt_name
+           | _ -> None)
+         dl)
+
   let check_no_duplicate_fields (s : pstruct) : unit =
     check_duplicates
       ~get_key:(fun (ident, _typ) -> ident.id)
@@ -62,16 +83,21 @@ module Validation = struct
           ident.id s.ps_name.id)
       s.ps_fields
 
+  (** the named results share the scope of the parameters, where any
+      number of them may be _ *)
   let check_no_duplicate_params (f : pfunc) : unit =
     check_duplicates
-      ~get_key:(fun (ident, _typ) -> ident.id)
-      ~on_duplicate:(fun (ident, _typ) ->
+      ~get_key:(fun ident -> ident.id)
+      ~on_duplicate:(fun ident ->
         errorm ~loc:ident.loc "duplicate parameter: %s for function: %s"
           ident.id f.pf_name.id)
-      f.pf_params
+      (List.filter
+         (fun ident -> not (Constants.is_blank ident.id))
+         (List.map fst f.pf_params @ f.pf_results))
 
-  let check_struct_cycles (structs : pstruct list) : unit =
-    let dep_graph = build_graph structs in
+  let check_struct_cycles (structs : pstruct list) (types : ptype list) :
+      unit =
+    let dep_graph = build_graph structs types in
     let cycles = detect_cycles structs dep_graph in
     if cycles <> [] then
       errorm "Found following cycles in the structures declarations:\n%s"
@@ -88,7 +114,112 @@ module Validation = struct
             (List.length main_func.fn_typ)
     | None -> errorm "function main is not defined"
 
-  let check_fmt_import_used (has_import : bool) (fmt_print_used : bool) : unit =
+  (** [loc] only names the file that imports fmt *)
+  let check_fmt_import_used ~loc (has_import : bool) (fmt_print_used : bool) :
+      unit =
     if has_import && not fmt_print_used then
-      errorm "imported package fmt is not used"
-end
\ No newline at end of file
+      errorm ~loc "imported package fmt is not used"
+
+  (** [imp] is the import of os, if any *)
+  let check_os_import_used (imp : ident option) (os_used : bool) : unit =
+    match imp with
+    | Some imp when not os_used ->
+        errorm ~loc:imp.loc "imported package os is not used"
+    | _ -> ()
+
+  let check_no_duplicate_imports (imports : imports) : unit =
+    check_duplicates
+      ~get_key:(fun ident -> ident.id)
+      ~on_duplicate:(fun _ ident ->
+        errorm ~loc:ident.loc "%s redeclared in this block" ident.id)
+      imports
+
+  (* for i := 0; ...; ... { ... } is parsed as a block of the initialization
+     and the loop, at the same location, and so is switch x := e; x { ... } *)
+  let label_target (s : pexpr) : label_target =
+    match s.pexpr_desc with
+    | PEfor _ -> Loop
+    | PEblock [ _; { pexpr_desc = PEfor _; pexpr_loc } ]
+      when pexpr_loc = s.pexpr_loc ->
+        Loop
+    | PEswitch _ -> Switch
+    | PEblock [ _; { pexpr_desc = PEswitch _; pexpr_loc } ]
+      when pexpr_loc = s.pexpr_loc ->
+        Switch
+    | _ -> Statement
+
+  (** The labels of a function are visible in all of its body, but a goto
+      cannot jump into a block, nor over a variable declaration of the
+      block of its label; break L and continue L must be in the statement
+      labeled L, a loop, or a switch for break. Every label must be used *)
+  let check_labels (f : pfunc) : unit =
+    (* each label and goto with its enclosing blocks, innermost first, and
+       the index of the statement in each of them *)
+    let labels = ref [] and gotos = ref [] and used = ref [] in
+    let rec stmt blocks targets (e : pexpr) =
+      match e.pexpr_desc with
+      | PElabel (id, s) ->
+          (match List.find_opt (fun (l, _) -> l.id = id.id) !labels with
+          | Some (first, _) ->
+              errorm ~loc:id.loc "label %s already defined at %s" id.id
+                (string_of_loc first.loc)
+          | None -> labels := (id, blocks) :: !labels);
+          stmt blocks ((id.id, label_target s) :: targets) s
+      | PEgoto id ->
+          used := id.id :: !used;
+          gotos := (id, blocks) :: !gotos
+      | PEbreak (Some id) -> jump targets id "break" (fun t -> t <> Statement)
+      | PEcontinue (Some id) -> jump targets id "continue" (fun t -> t = Loop)
+      | PEblock sl ->
+          List.iteri (fun i s -> stmt ((e, i) :: blocks) targets s) sl
+      | PEif (_, e1, e2) ->
+          stmt blocks targets e1;
+          stmt blocks targets e2
+      | PEfor (_, _, body) -> stmt blocks targets body
+      | PEswitch (_, clauses) ->
+          List.iter (fun (_, body) -> stmt blocks targets body) clauses
+      | _ -> ()
+    and jump targets id kind allowed =
+      used := id.id :: !used;
+      match List.assoc_opt id.id targets with
+      | Some t when allowed t -> ()
+      | _ -> errorm ~loc:id.loc "invalid %s label %s" kind id.id
+    in
+    stmt [] [] f.pf_body;
+    let rec declaration (s : pexpr) =
+      match s.pexpr_desc with
+      | PEvars (id :: _, _, _) | PEdefine (id :: _, _) -> Some id
+      | PElabel (_, s) -> declaration s
+      | _ -> None
+    in
+    let goto ((id : ident), blocks) =
+      match List.find_opt (fun (l, _) -> l.id = id.id) !labels with
+      | None -> errorm ~loc:id.loc "label %s not defined" id.id
+      | Some (_, []) -> assert false
+      | Some (_, (block, j) :: _) -> (
+          match List.assq_opt block blocks with
+          | None ->
+              errorm ~loc:id.loc "goto %s jumps into block starting at %s"
+                id.id (string_of_loc block.pexpr_loc)
+          | Some i -> (
+              let sl =
+                match block.pexpr_desc with PEblock sl -> sl | _ -> []
+              in
+              List.iteri
+                (fun k s ->
+                  if i < k && k < j then
+                    match declaration s with
+                    | Some v ->
+                        errorm ~loc:id.loc
+                          "goto %s jumps over variable declaration at line %d"
+                          id.id (fst v.loc).Lexing.pos_lnum
+                    | None -> ())
+                sl))
+    in
+    List.iter goto (List.rev !gotos);
+    List.iter
+      (fun ((id : ident), _) ->
+        if not (List.mem id.id !used) then
+          errorm ~loc:id.loc "label %s defined and not used" id.id)
+      (List.rev !labels)
+end
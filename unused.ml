@@ -7,5 +7,7 @@ let rec collect_declared_vars (e : expr) : var list =
   | TEif (_, then_e, else_e) ->
       collect_declared_vars then_e @ collect_declared_vars else_e
   | TEblock exprs -> List.flatten (List.map collect_declared_vars exprs)
-  | TEfor (_, body) -> collect_declared_vars body
+  | TEfor (_, _, body) -> collect_declared_vars body
+  | TEswitch clauses ->
+      List.concat_map (fun (_, body, _) -> collect_declared_vars body) clauses
   | _ -> []
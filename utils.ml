@@ -5,14 +5,26 @@ let rec string_of_ptyp (t : ptyp) : string =
   match t with
   | PTident ident -> ident.id
   | PTptr ptr -> "*" ^ string_of_ptyp ptr
+  | PTarray ({ pexpr_desc = PEconstant (Cint n) }, t) ->
+      "[" ^ Int64.to_string n ^ "]" ^ string_of_ptyp t
+  | PTarray (_, t) -> "[...]" ^ string_of_ptyp t
+  | PTslice t -> "[]" ^ string_of_ptyp t
+  | PTmap (k, v) -> "map[" ^ string_of_ptyp k ^ "]" ^ string_of_ptyp v
 
 let rec string_of_typ = function
   | Tint -> "int"
+  | Tfloat -> "float64"
+  | Tinteger (bits, signed) ->
+      (if signed then "int" else "uint") ^ string_of_int bits
   | Tbool -> "bool"
   | Tstring -> "string"
   | Tnil -> "nil"
   | Tstruct s -> s.s_name
+  | Tnamed (name, _) -> name
   | Tptr t -> "*" ^ string_of_typ t
+  | Tarray (t, n) -> "[" ^ string_of_int n ^ "]" ^ string_of_typ t
+  | Tslice t -> "[]" ^ string_of_typ t
+  | Tmap (k, v) -> "map[" ^ string_of_typ k ^ "]" ^ string_of_typ v
   | Tmany ts -> "(" ^ String.concat ", " (List.map string_of_typ ts) ^ ")"
 
 let string_of_binop = function
@@ -29,6 +41,12 @@ let string_of_binop = function
   | Bge -> ">="
   | Band -> "&&"
   | Bor -> "||"
+  | Bbitand -> "&"
+  | Bbitor -> "|"
+  | Bxor -> "^"
+  | Bandnot -> "&^"
+  | Bshl -> "<<"
+  | Bshr -> ">>"
 
 let check_duplicates ~get_key ~on_duplicate list =
   begin
@@ -47,9 +65,22 @@ let check_duplicates ~get_key ~on_duplicate list =
 
 let rec types_equal (t1 : typ) (t2 : typ) : bool =
   match (t1, t2) with
-  | Tint, Tint | Tbool, Tbool | Tstring, Tstring -> true
+  | Tint, Tint | Tbool, Tbool | Tstring, Tstring | Tfloat, Tfloat -> true
+  | Tinteger (b1, s1), Tinteger (b2, s2) -> b1 = b2 && s1 = s2
   | Tnil, Tnil -> true
   | Tptr t1', Tptr t2' -> types_equal t1' t2'
+  | Tarray (t1', n1), Tarray (t2', n2) -> n1 = n2 && types_equal t1' t2'
+  | Tslice t1', Tslice t2' -> types_equal t1' t2'
+  | Tmap (k1, v1), Tmap (k2, v2) -> types_equal k1 k2 && types_equal v1 v2
   | Tstruct s1, Tstruct s2 -> s1.s_name = s2.s_name
   | Tnil, Tptr _ | Tptr _, Tnil -> true (* nil compatible with any pointer *)
+  | Tnil, Tslice _ | Tslice _, Tnil -> true (* and with any slice *)
+  | Tnil, Tmap _ | Tmap _, Tnil -> true (* or map *)
+  | Tnamed (n1, _), Tnamed (n2, _) -> n1 = n2
+  (* a value of a type without a name, nil, a literal, may have a named type
+     with the same structure *)
+  | Tnamed (_, t1'), (Tnil | Tptr _ | Tarray _ | Tslice _ | Tmap _) ->
+      types_equal (Lazy.force t1') t2
+  | (Tnil | Tptr _ | Tarray _ | Tslice _ | Tmap _), Tnamed (_, t2') ->
+      types_equal t1 (Lazy.force t2')
   | _ -> false
@@ -82,6 +82,9 @@ let r13b = "%r13b"
 let r14b = "%r14b"
 let r15b = "%r15b"
 
+let xmm0 = "%xmm0"
+let xmm1 = "%xmm1"
+
 let register8 = function
   | "%rax" -> al
   | "%rbx" -> bl
@@ -228,6 +231,7 @@ let imull a b = ins "imull %a, %a" a () b ()
 let imulq a b = ins "imulq %a, %a" a () b ()
 
 let idivq a = ins "idivq %a" a ()
+let divq a = ins "divq %a" a ()
 let cqto = S "\tcqto\n"
 
 let notb a = ins "notb %a" a ()
@@ -265,6 +269,10 @@ let sarw a b = ins "sarw %a, %a" a () b ()
 let sarl a b = ins "sarl %a, %a" a () b ()
 let sarq a b = ins "sarq %a, %a" a () b ()
 
+let shlq_cl a = ins "shlq %%cl, %a" a ()
+let shrq_cl a = ins "shrq %%cl, %a" a ()
+let sarq_cl a = ins "sarq %%cl, %a" a ()
+
 let jmp (z: label) = ins "jmp %a" mangle z
 let jmp_star o = ins "jmp *%a" o ()
 
@@ -298,6 +306,22 @@ let testw a b = ins "testw %a, %a" a () b ()
 let testl a b = ins "testl %a, %a" a () b ()
 let testq a b = ins "testq %a, %a" a () b ()
 
+let movq_to_xmm r x = ins "movq %s, %s" r x
+let movq_of_xmm x r = ins "movq %s, %s" x r
+
+let addsd a b = ins "addsd %s, %s" a b
+let subsd a b = ins "subsd %s, %s" a b
+let mulsd a b = ins "mulsd %s, %s" a b
+let divsd a b = ins "divsd %s, %s" a b
+
+let ucomisd a b = ins "ucomisd %s, %s" a b
+
+let cvtsi2sdq a x = ins "cvtsi2sdq %a, %s" a () x
+let cvttsd2siq x r = ins "cvttsd2siq %s, %s" x r
+
+let setp  a = ins "setp %a" a ()
+let setnp a = ins "setnp %a" a ()
+
 let sete  a = ins "sete %a" a ()
 let setne a = ins "setne %a" a ()
 let setz  a = ins "setz %a" a ()
@@ -334,7 +358,18 @@ let dbyte l = ins ".byte %a" pr_ilist l
 let dint  l = ins ".int %a" pr_ilist l
 let dword l = ins ".word %a" pr_ilist l
 let dquad l = ins ".quad %a" pr_ilist l
-let string s = ins ".string %S" s
+(* GAS lit \ddd en octal, alors que %S écrit les octets en décimal *)
+let escape_string s =
+  let b = Buffer.create (String.length s) in
+  String.iter
+    (function
+      | ('"' | '\\') as c -> Buffer.add_char b '\\'; Buffer.add_char b c
+      | ' ' .. '~' as c -> Buffer.add_char b c
+      | c -> Buffer.add_string b (Printf.sprintf "\\%03o" (Char.code c)))
+    s;
+  Buffer.contents b
+
+let string s = ins ".string \"%s\"" (escape_string s)
 
 let address l = ins ".quad %a" pr_alist l
 let space n = ins ".space %d" n
@@ -352,6 +387,18 @@ let rec pr_asm fmt = function
   | S s          -> fprintf fmt "%s" s
   | Cat (a1, a2) -> pr_asm fmt a1; pr_asm fmt a2
 
+let lines a =
+  let b = Buffer.create 4096 in
+  let rec add = function
+    | Nop -> ()
+    | S s -> Buffer.add_string b s
+    | Cat (a1, a2) -> add a1; add a2
+  in
+  add a;
+  match List.rev (String.split_on_char '\n' (Buffer.contents b)) with
+  | "" :: l -> List.rev l
+  | l -> List.rev l
+
 let print_program fmt p =
   fprintf fmt "\t.text\n";
   pr_asm fmt p.text;
@@ -46,6 +46,10 @@ val print_program : Format.formatter -> program -> unit
 
 val print_in_file: file:string -> program -> unit
 
+val lines: 'a asm -> string list
+  (** [lines a] renvoie les lignes du code [a], dans l'ordre, sans leur
+      caractère de fin de ligne *)
+
 (** {1 Registres } *)
 
 type size = [`B | `W | `L | `Q]
@@ -132,6 +136,10 @@ val r15b: [`B] register
 val register8: [`Q] register -> [`B] register
   (** accès au registre des 8 bits faibles d'un registre 64 bits *)
 
+val xmm0: [`X] register
+val xmm1: [`X] register
+  (** registres flottants (SSE) *)
+
 (** {1 Opérandes } *)
 
 type 'size operand
@@ -242,6 +250,7 @@ val imull: [`L] operand -> [`L] operand -> text
 val imulq: [`Q] operand -> [`Q] operand -> text
 
 val idivq: [`Q] operand -> text
+val divq: [`Q] operand -> text
 val cqto: text
 
 (** {2 Opérations logiques } *)
@@ -286,6 +295,11 @@ val sarw: [`W] operand -> [`W] operand -> text
 val sarl: [`L] operand -> [`L] operand -> text
 val sarq: [`Q] operand -> [`Q] operand -> text
 
+val shlq_cl: [`Q] operand -> text
+val shrq_cl: [`Q] operand -> text
+val sarq_cl: [`Q] operand -> text
+  (** décalages du nombre de bits donné par %cl *)
+
 (** {2 Sauts } *)
 
 val call: label -> text
@@ -344,6 +358,28 @@ val setb : [`B] operand -> text  (* <  non signé *)
 val setbe: [`B] operand -> text  (* <= non signé *)
   (** positionne l'octet opérande à 1 ou 0 selon que le test est vrai ou non *)
 
+(** {2 Flottants (double précision) } *)
+
+val movq_to_xmm: [`Q] register -> [`X] register -> text
+val movq_of_xmm: [`X] register -> [`Q] register -> text
+  (** copie des 64 bits entre un registre et un registre flottant *)
+
+val addsd: [`X] register -> [`X] register -> text
+val subsd: [`X] register -> [`X] register -> text
+val mulsd: [`X] register -> [`X] register -> text
+val divsd: [`X] register -> [`X] register -> text
+
+val ucomisd: [`X] register -> [`X] register -> text
+  (** comparaison ; positionne les drapeaux comme une comparaison non signée,
+      et le drapeau de parité si l'un des opérandes est NaN *)
+
+val cvtsi2sdq: [`Q] operand -> [`X] register -> text
+val cvttsd2siq: [`X] register -> [`Q] register -> text
+  (** conversions entier -> flottant et flottant -> entier (troncature) *)
+
+val setp : [`B] operand -> text  (* parité : non ordonné *)
+val setnp: [`B] operand -> text  (* pas de parité : ordonné *)
+
 (** {2 Manipulation de la pile} *)
 
 val pushq : [`Q] operand -> text